@@ -0,0 +1,131 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lfeier/dpctl/deploy"
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var scmd = &cobra.Command{
+		Use:   "action <ActionName>",
+		Short: "Execute a DataPower action queue operation",
+		Long: `Execute a DataPower action queue operation, e.g. SaveConfig, FlushDocumentCache or
+TestURLMap. The parameters are given as --param name=value or as a JSON file with
+--input, the --param values override the file ones. The asynchronous actions are
+followed until completion or --action-timeout.`,
+		Args:   cobra.ExactArgs(1),
+		PreRun: preRunAction,
+		Run:    runAction,
+	}
+
+	CmdRoot.AddCommand(scmd)
+
+	addVerboseFlag(scmd)
+	addDPRestMgmtURLFlag(scmd)
+	addDPUserNameFlag(scmd)
+	addDPUserPasswordFlag(scmd)
+	addDomainFlag(scmd)
+	addHTTPTimeoutFlag(scmd)
+	addParamFlag(scmd)
+	addInputFlag(scmd)
+	addActionTimeoutFlag(scmd)
+	addOutputFlag(scmd, "json", "output format: json")
+	addTemplateFlag(scmd)
+	addRetryFlags(scmd)
+}
+
+func preRunAction(cmd *cobra.Command, args []string) {
+	level, _ := getVerboseFlagValue(cmd)
+	log.SetVebosity(level)
+}
+
+func runAction(cmd *cobra.Command, args []string) {
+	if err := runActionE(cmd, args); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+	}
+}
+
+func runActionE(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	params, _ := getParamFlagValue(cmd)
+	log.DbgLogger1.Printf("--param=%v", params)
+
+	input, _ := getInputFlagValue(cmd)
+	log.DbgLogger1.Printf("--input=%v", input)
+
+	actionTimeout, _ := getActionTimeoutFlagValue(cmd)
+	log.DbgLogger1.Printf("--action-timeout=%v", actionTimeout)
+
+	output, _ := getOutputFlagValue(cmd)
+	log.DbgLogger1.Printf("--output=%v", output)
+
+	template, _ := getTemplateFlagValue(cmd)
+	log.DbgLogger1.Printf("--template=%v", template)
+
+	actionParams, err := actionParams(input, params)
+	if err != nil {
+		return err
+	}
+
+	log.DbgLogger4.Println("action parameters:", actionParams)
+
+	dp := getClientFlagValues(cmd, 1)
+
+	res, err := deploy.ExecuteAction(cmdContext, dp, name, actionParams, actionTimeout)
+	if res != nil {
+		if err := util.OutputData(res, output, template); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// actionParams merges the parameters of the input file and the name=value parameters
+func actionParams(input string, params []string) (util.GenericMap, error) {
+	m := util.GenericMap{}
+
+	if input != "" {
+		data, err := util.ReadDataFromFile(input)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		m, ok = data.(util.GenericMap)
+		if !ok {
+			return nil, fmt.Errorf("invalid action parameters, JSON object expected: %s", input)
+		}
+	}
+
+	for _, p := range params {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid action parameter, name=value expected: %s", p)
+		}
+
+		m[kv[0]] = kv[1]
+	}
+
+	return m, nil
+}
@@ -0,0 +1,98 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/pflag"
+)
+
+func TestActionCmdFlags(t *testing.T) {
+	a := []string{
+		"action",
+	}
+	cmd, _, err := CmdRoot.Find(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		switch f.Name {
+		case
+			"verbose",
+			"dp-rest-mgmt-url",
+			"dp-user-name",
+			"dp-user-password",
+			"domain",
+			"http-timeout",
+			"param",
+			"input",
+			"action-timeout",
+			"output",
+			"template",
+			"retry-max-attempts",
+			"retry-backoff",
+			"retry-max-backoff",
+			"retry-status-codes":
+			n++
+		default:
+			t.Errorf("Unknown flag '%v'", f.Name)
+		}
+	})
+
+	expected := 15
+	if n != expected {
+		t.Errorf("Expected '%v' flags, got '%v'", expected, n)
+	}
+}
+
+func TestActionParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"params.json": `{"XMLManager": "default", "Timeout": 60}`,
+		"array.json":  `[]`,
+	})
+
+	m, err := actionParams(filepath.Join(dir, "params.json"), []string{"XMLManager=xm", "URL=http://h/?a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := util.GenericMap{"XMLManager": "xm", "Timeout": float64(60), "URL": "http://h/?a=b"}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, m)
+	}
+
+	if _, err := actionParams("", []string{"XMLManager"}); err == nil {
+		t.Errorf("Expected an invalid parameter error")
+	}
+
+	if _, err := actionParams(filepath.Join(dir, "array.json"), nil); err == nil {
+		t.Errorf("Expected an invalid parameters file error")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/lfeier/dpctl/deploy"
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var scmd = &cobra.Command{
+		Use:   "domain",
+		Short: "Manage DataPower application domains",
+		Long:  ``,
+	}
+
+	CmdRoot.AddCommand(scmd)
+
+	var ccmd = &cobra.Command{
+		Use:    "create",
+		Short:  "Create a DataPower application domain",
+		Long:   ``,
+		PreRun: preRunDomainCreate,
+		Run:    runDomainCreate,
+	}
+
+	scmd.AddCommand(ccmd)
+
+	addVerboseFlag(ccmd)
+	addDPRestMgmtURLFlag(ccmd)
+	addDPUserNameFlag(ccmd)
+	addDPUserPasswordFlag(ccmd)
+	addDomainFlag(ccmd)
+	addHTTPTimeoutFlag(ccmd)
+	addProjectDirFlag(ccmd)
+	addPkgTagsFlag(ccmd)
+	addPkgSelectorFlag(ccmd)
+	addPackagesFlag(ccmd)
+	addDomainTimeoutFlag(ccmd)
+	addRetryFlags(ccmd)
+}
+
+func preRunDomainCreate(cmd *cobra.Command, args []string) {
+	level, _ := getVerboseFlagValue(cmd)
+	log.SetVebosity(level)
+}
+
+func runDomainCreate(cmd *cobra.Command, args []string) {
+	if err := runDomainCreateE(cmd, args); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+	}
+}
+
+func runDomainCreateE(cmd *cobra.Command, args []string) error {
+	projectDir, _ := getProjectDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
+
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
+
+	domainTimeout, _ := getDomainTimeoutFlagValue(cmd)
+	log.DbgLogger1.Printf("--domain-timeout=%v", domainTimeout)
+
+	allPackages, err := util.ProjectPackages(projectDir)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := util.SelectPackages(allPackages, selector)
+	if err != nil {
+		return err
+	}
+
+	if len(pkgs) == 0 {
+		return errors.New("no packages selected")
+	}
+
+	dp := getClientFlagValues(cmd, 1)
+
+	opts := &deploy.DomainOptions{
+		Packages: pkgs,
+		Timeout:  domainTimeout,
+		Hooks:    newItemPrinter(0).hooks(),
+	}
+
+	report, err := deploy.CreateDomain(cmdContext, dp, opts)
+	printReport(report)
+
+	return err
+}
@@ -0,0 +1,138 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/lfeier/dpctl/deploy"
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var scmd = &cobra.Command{
+		Use:   "fmt",
+		Short: "Format the project object files",
+		Long: `Rewrite the project object and patch files in the canonical format used by pull:
+sorted keys, the package indent, a trailing newline and the order-insensitive arrays
+declared by the package sorted. Only the files changed are listed. With --check
+nothing is rewritten and the command fails if a file is not formatted.`,
+		PreRun: preRunFmt,
+		Run:    runFmt,
+	}
+
+	CmdRoot.AddCommand(scmd)
+
+	addVerboseFlag(scmd)
+	addProjectDirFlag(scmd)
+	addPkgTagsFlag(scmd)
+	addPkgSelectorFlag(scmd)
+	addPackagesFlag(scmd)
+	addObjectsFlag(scmd)
+	addIgnoreObjectsFlag(scmd)
+	addCheckFlag(scmd)
+}
+
+func preRunFmt(cmd *cobra.Command, args []string) {
+	level, _ := getVerboseFlagValue(cmd)
+	log.SetVebosity(level)
+}
+
+func runFmt(cmd *cobra.Command, args []string) {
+	if err := runFmtE(cmd, args); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func runFmtE(cmd *cobra.Command, args []string) error {
+	projectDir, _ := getProjectDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
+
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
+
+	objects, _ := getObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--objects=%v", objects)
+
+	ignoreObjects, _ := getIgnoreObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--ignore-objects=%v", ignoreObjects)
+
+	check, _ := getCheckFlagValue(cmd)
+	log.DbgLogger1.Printf("--check=%v", check)
+
+	reObjects := regexp.MustCompile(strings.Join(objects, "|"))
+	log.DbgLogger4.Println("objects regexp:", reObjects.String())
+
+	reIgnoreObjects := regexp.MustCompile(strings.Join(ignoreObjects, "|"))
+	log.DbgLogger4.Println("ignore objects regexp:", reIgnoreObjects.String())
+
+	allPackages, err := util.ProjectPackages(projectDir)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := util.SelectPackages(allPackages, selector)
+	if err != nil {
+		return err
+	}
+
+	if len(pkgs) == 0 {
+		return errors.New("no packages selected")
+	}
+
+	log.DbgLogger1.Println("packages selected:")
+	for _, pkg := range pkgs {
+		log.DbgLogger1.Printf("  package: %s (priority %d)", pkg.Name, pkg.Priority)
+	}
+
+	p := newItemPrinter(maxFmtResultLength)
+	hooks := p.hooks()
+	hooks.Done = func(res *deploy.Result) {
+		if res.Status != deploy.StatusSame {
+			p.done(res)
+		}
+	}
+
+	opts := &deploy.FmtOptions{
+		Packages: pkgs,
+		Objects: deploy.Filter{
+			Include: reObjects,
+			Ignore:  reIgnoreObjects,
+		},
+		Check: check,
+		Hooks: hooks,
+	}
+
+	report, err := deploy.Fmt(cmdContext, opts)
+
+	printReport(report)
+
+	if err == deploy.ErrInterrupted {
+		return errors.New("fmt interrupted")
+	}
+
+	return err
+}
+
+// maxFmtResultLength is the length of the longest fmt result: NOT-ATTEMPTED
+var maxFmtResultLength = 13
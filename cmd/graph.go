@@ -0,0 +1,320 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var scmd = &cobra.Command{
+		Use:    "graph",
+		Short:  "Export the dependency graph of the project objects",
+		Long:   ``,
+		PreRun: preRunGraph,
+		Run:    runGraph,
+	}
+
+	CmdRoot.AddCommand(scmd)
+
+	addVerboseFlag(scmd)
+	addProjectDirFlag(scmd)
+	addPkgTagsFlag(scmd)
+	addPkgSelectorFlag(scmd)
+	addPackagesFlag(scmd)
+	addObjectsFlag(scmd)
+	addIgnoreObjectsFlag(scmd)
+	addOutputFlag(scmd, "dot", "output format: dot, json or mermaid")
+	addFromFlag(scmd)
+	addToFlag(scmd)
+	addColorByPackageFlag(scmd)
+}
+
+func preRunGraph(cmd *cobra.Command, args []string) {
+	level, _ := getVerboseFlagValue(cmd)
+	log.SetVebosity(level)
+}
+
+func runGraph(cmd *cobra.Command, args []string) {
+	if err := runGraphE(cmd, args); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+	}
+}
+
+func runGraphE(cmd *cobra.Command, args []string) error {
+	projectDir, _ := getProjectDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
+
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
+
+	objects, _ := getObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--objects=%v", objects)
+
+	ignoreObjects, _ := getIgnoreObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--ignore-objects=%v", ignoreObjects)
+
+	output, _ := getOutputFlagValue(cmd)
+	log.DbgLogger1.Printf("--output=%v", output)
+
+	from, _ := getFromFlagValue(cmd)
+	log.DbgLogger1.Printf("--from=%v", from)
+
+	to, _ := getToFlagValue(cmd)
+	log.DbgLogger1.Printf("--to=%v", to)
+
+	colorByPackage, _ := getColorByPackageFlagValue(cmd)
+	log.DbgLogger1.Printf("--color-by-package=%v", colorByPackage)
+
+	reObjects := regexp.MustCompile(strings.Join(objects, "|"))
+	log.DbgLogger4.Println("objects regexp:", reObjects.String())
+
+	reIgnoreObjects := regexp.MustCompile(strings.Join(ignoreObjects, "|"))
+	log.DbgLogger4.Println("ignore objects regexp:", reIgnoreObjects.String())
+
+	allPackages, err := util.ProjectPackages(projectDir)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := util.SelectPackages(allPackages, selector)
+	if err != nil {
+		return err
+	}
+
+	if len(pkgs) == 0 {
+		return errors.New("no packages selected")
+	}
+
+	projectObjects, err := util.GetProjectObjects(pkgs)
+	if err != nil {
+		return err
+	}
+
+	matchingObjects := projectObjects[:0]
+	for _, objInfo := range projectObjects {
+		qn := objInfo.QName()
+
+		if !reObjects.MatchString(qn) || reIgnoreObjects.MatchString(qn) {
+			log.DbgLogger2.Println("object ignored:", qn)
+			continue
+		}
+
+		matchingObjects = append(matchingObjects, objInfo)
+	}
+
+	g := filterGraph(util.NewObjectGraph(matchingObjects), from, to)
+
+	var colors map[string]string
+	if colorByPackage {
+		colors = packageColors(pkgs)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+
+	if err := writeGraph(w, g, output, colors); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// filterGraph keeps the nodes reachable from the nodes matching from
+// and the nodes pointing to the nodes matching to
+func filterGraph(g *util.ObjectGraph, from, to []string) *util.ObjectGraph {
+	if len(from) == 0 && len(to) == 0 {
+		return g
+	}
+
+	keep := make(map[string]bool)
+
+	if len(from) > 0 {
+		reFrom := regexp.MustCompile(strings.Join(from, "|"))
+		log.DbgLogger4.Println("from regexp:", reFrom.String())
+
+		for qn := range g.Reachable(matchingQNames(g, reFrom), false) {
+			keep[qn] = true
+		}
+	}
+
+	if len(to) > 0 {
+		reTo := regexp.MustCompile(strings.Join(to, "|"))
+		log.DbgLogger4.Println("to regexp:", reTo.String())
+
+		for qn := range g.Reachable(matchingQNames(g, reTo), true) {
+			keep[qn] = true
+		}
+	}
+
+	return g.Subgraph(keep)
+}
+
+func matchingQNames(g *util.ObjectGraph, re *regexp.Regexp) []string {
+	var s []string
+
+	for _, qn := range g.QNames() {
+		if re.MatchString(qn) {
+			s = append(s, qn)
+		}
+	}
+
+	return s
+}
+
+var graphPalette = []string{
+	"#8dd3c7",
+	"#ffffb3",
+	"#bebada",
+	"#fb8072",
+	"#80b1d3",
+	"#fdb462",
+	"#b3de69",
+	"#fccde5",
+	"#d9d9d9",
+	"#bc80bd",
+	"#ccebc5",
+	"#ffed6f",
+}
+
+func packageColors(pkgs util.PackageSlice) map[string]string {
+	m := make(map[string]string)
+
+	for i, pkg := range pkgs {
+		m[pkg.Name] = graphPalette[i%len(graphPalette)]
+	}
+
+	return m
+}
+
+func writeGraph(w io.Writer, g *util.ObjectGraph, format string, colors map[string]string) error {
+	switch format {
+	case "dot":
+		return writeGraphDot(w, g, colors)
+	case "json":
+		return writeGraphJSON(w, g)
+	case "mermaid":
+		return writeGraphMermaid(w, g, colors)
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+func writeGraphDot(w io.Writer, g *util.ObjectGraph, colors map[string]string) error {
+	fmt.Fprintln(w, "digraph dpctl {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+
+	for _, qn := range g.QNames() {
+		var attrs []string
+
+		if g.IsExternal(qn) {
+			attrs = append(attrs, "style=dashed")
+		} else if c, ok := colors[g.Nodes[qn].Package.Name]; ok {
+			attrs = append(attrs, "style=filled", fmt.Sprintf("fillcolor=%q", c))
+			attrs = append(attrs, fmt.Sprintf("tooltip=%q", g.Nodes[qn].Package.Name))
+		}
+
+		if len(attrs) > 0 {
+			fmt.Fprintf(w, "  %q [%s];\n", qn, strings.Join(attrs, ", "))
+		} else {
+			fmt.Fprintf(w, "  %q;\n", qn)
+		}
+	}
+
+	for _, qn := range g.QNames() {
+		for _, d := range g.Edges[qn] {
+			fmt.Fprintf(w, "  %q -> %q;\n", qn, d)
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+
+	return err
+}
+
+func writeGraphJSON(w io.Writer, g *util.ObjectGraph) error {
+	m := make(map[string][]string)
+
+	for _, qn := range g.QNames() {
+		d := g.Edges[qn]
+		if d == nil {
+			d = []string{}
+		}
+
+		m[qn] = d
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(b))
+
+	return err
+}
+
+func writeGraphMermaid(w io.Writer, g *util.ObjectGraph, colors map[string]string) error {
+	fmt.Fprintln(w, "graph LR")
+
+	ids := make(map[string]string)
+	for i, qn := range g.QNames() {
+		ids[qn] = fmt.Sprintf("n%d", i)
+
+		if g.IsExternal(qn) {
+			fmt.Fprintf(w, "  %s([\"%s\"])\n", ids[qn], qn)
+		} else {
+			fmt.Fprintf(w, "  %s[\"%s\"]\n", ids[qn], qn)
+		}
+	}
+
+	for _, qn := range g.QNames() {
+		for _, d := range g.Edges[qn] {
+			fmt.Fprintf(w, "  %s --> %s\n", ids[qn], ids[d])
+		}
+	}
+
+	if colors != nil {
+		classes := make(map[string]string)
+		for i, qn := range g.QNames() {
+			if g.IsExternal(qn) {
+				continue
+			}
+
+			pkg := g.Nodes[qn].Package.Name
+			if _, ok := classes[pkg]; !ok {
+				classes[pkg] = fmt.Sprintf("pkg%d", len(classes))
+				fmt.Fprintf(w, "  classDef %s fill:%s\n", classes[pkg], colors[pkg])
+			}
+
+			fmt.Fprintf(w, "  class n%d %s\n", i, classes[pkg])
+		}
+	}
+
+	return nil
+}
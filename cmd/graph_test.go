@@ -0,0 +1,122 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/pflag"
+)
+
+func TestGraphCmdFlags(t *testing.T) {
+	a := []string{
+		"graph",
+	}
+	cmd, _, err := CmdRoot.Find(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		switch f.Name {
+		case
+			"verbose",
+			"project-dir",
+			"pkg-tags",
+			"pkg-selector",
+			"packages",
+			"objects",
+			"ignore-objects",
+			"output",
+			"from",
+			"to",
+			"color-by-package":
+			n++
+		default:
+			t.Errorf("Unknown flag '%v'", f.Name)
+		}
+	})
+
+	expected := 11
+	if n != expected {
+		t.Errorf("Expected '%v' flags, got '%v'", expected, n)
+	}
+}
+
+func TestGraphOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"pkg1/metadata.json":                        `{"priority": 1}`,
+		"pkg1/objects/MultiProtocolGateway/gw.json": `{"name": "gw", "StylePolicy": {"value": "sp", "href": "/mgmt/config/{domain}/StylePolicy/sp"}}`,
+		"pkg1/objects/StylePolicy/sp.json":          `{"name": "sp", "XMLManager": {"value": "default", "href": "/mgmt/config/{domain}/XMLManager/default"}}`,
+		"pkg1/objects/StylePolicy/other.json":       `{"name": "other"}`,
+	})
+
+	pkgs, err := util.ProjectPackages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := util.GetProjectObjects(pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := filterGraph(util.NewObjectGraph(objects), []string{"^MultiProtocolGateway/"}, nil)
+
+	var b bytes.Buffer
+	if err := writeGraph(&b, g, "dot", packageColors(pkgs)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `digraph dpctl {
+  rankdir=LR;
+  node [shape=box];
+  "MultiProtocolGateway/gw" [style=filled, fillcolor="#8dd3c7", tooltip="pkg1"];
+  "StylePolicy/sp" [style=filled, fillcolor="#8dd3c7", tooltip="pkg1"];
+  "XMLManager/default" [style=dashed];
+  "MultiProtocolGateway/gw" -> "StylePolicy/sp";
+  "StylePolicy/sp" -> "XMLManager/default";
+}
+`
+	if b.String() != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, b.String())
+	}
+
+	b.Reset()
+	if err := writeGraph(&b, filterGraph(g, nil, []string{"^StylePolicy/sp$"}), "mermaid", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `graph LR
+  n0["MultiProtocolGateway/gw"]
+  n1["StylePolicy/sp"]
+  n0 --> n1
+`
+	if b.String() != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, b.String())
+	}
+}
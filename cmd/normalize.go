@@ -0,0 +1,139 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/lfeier/dpctl/deploy"
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var scmd = &cobra.Command{
+		Use:   "normalize",
+		Short: "Remove the default valued and the read-only properties from the project objects",
+		Long: `Rewrite the project object files without the properties having the class default
+value, the read-only properties and the --ignore-properties ones, as pull --normalize
+does for the pulled objects. The class metadata is loaded from DataPower, the patch
+files and the imported packages are not changed.`,
+		PreRun: preRunNormalize,
+		Run:    runNormalize,
+	}
+
+	CmdRoot.AddCommand(scmd)
+
+	addVerboseFlag(scmd)
+	addDPRestMgmtURLFlag(scmd)
+	addDPUserNameFlag(scmd)
+	addDPUserPasswordFlag(scmd)
+	addDomainFlag(scmd)
+	addHTTPTimeoutFlag(scmd)
+	addProjectDirFlag(scmd)
+	addPkgTagsFlag(scmd)
+	addPkgSelectorFlag(scmd)
+	addPackagesFlag(scmd)
+	addObjectsFlag(scmd)
+	addIgnoreObjectsFlag(scmd)
+	addIgnorePropertiesFlag(scmd)
+	addSchemaCacheDirFlag(scmd)
+	addRetryFlags(scmd)
+}
+
+func preRunNormalize(cmd *cobra.Command, args []string) {
+	level, _ := getVerboseFlagValue(cmd)
+	log.SetVebosity(level)
+}
+
+func runNormalize(cmd *cobra.Command, args []string) {
+	if err := runNormalizeE(cmd, args); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+	}
+}
+
+func runNormalizeE(cmd *cobra.Command, args []string) error {
+	projectDir, _ := getProjectDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
+
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
+
+	objects, _ := getObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--objects=%v", objects)
+
+	ignoreObjects, _ := getIgnoreObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--ignore-objects=%v", ignoreObjects)
+
+	reObjects := regexp.MustCompile(strings.Join(objects, "|"))
+	log.DbgLogger4.Println("objects regexp:", reObjects.String())
+
+	reIgnoreObjects := regexp.MustCompile(strings.Join(ignoreObjects, "|"))
+	log.DbgLogger4.Println("ignore objects regexp:", reIgnoreObjects.String())
+
+	allPackages, err := util.ProjectPackages(projectDir)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := util.SelectPackages(allPackages, selector)
+	if err != nil {
+		return err
+	}
+
+	if len(pkgs) == 0 {
+		return errors.New("no packages selected")
+	}
+
+	log.DbgLogger1.Println("packages selected:")
+	for _, pkg := range pkgs {
+		log.DbgLogger1.Printf("  package: %s (priority %d)", pkg.Name, pkg.Priority)
+	}
+
+	dp := getClientFlagValues(cmd, 1)
+
+	normalizer, err := getNormalizerFlagValues(cmd, dp)
+	if err != nil {
+		return err
+	}
+
+	opts := &deploy.NormalizeOptions{
+		Packages: pkgs,
+		Objects: deploy.Filter{
+			Include: reObjects,
+			Ignore:  reIgnoreObjects,
+		},
+		Normalizer: normalizer,
+		Hooks:      newItemPrinter(maxNormalizeResultLength).hooks(),
+	}
+
+	report, err := deploy.Normalize(cmdContext, opts)
+
+	printReport(report)
+
+	if err == deploy.ErrInterrupted {
+		return errors.New("normalize interrupted")
+	}
+
+	return err
+}
+
+// maxNormalizeResultLength is the length of the longest normalize result: NOT-ATTEMPTED
+var maxNormalizeResultLength = 13
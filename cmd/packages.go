@@ -0,0 +1,188 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var scmd = &cobra.Command{
+		Use:    "packages",
+		Short:  "List the project packages and whether the package selection picks them",
+		Long:   ``,
+		PreRun: preRunPackages,
+		Run:    runPackages,
+	}
+
+	CmdRoot.AddCommand(scmd)
+
+	addVerboseFlag(scmd)
+	addProjectDirFlag(scmd)
+	addPkgTagsFlag(scmd)
+	addPkgSelectorFlag(scmd)
+	addPackagesFlag(scmd)
+	addOutputFlag(scmd, "table", "output format: table or json")
+}
+
+func preRunPackages(cmd *cobra.Command, args []string) {
+	level, _ := getVerboseFlagValue(cmd)
+	log.SetVebosity(level)
+}
+
+func runPackages(cmd *cobra.Command, args []string) {
+	if err := runPackagesE(cmd, args); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+	}
+}
+
+func runPackagesE(cmd *cobra.Command, args []string) error {
+	projectDir, _ := getProjectDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
+
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
+
+	output, _ := getOutputFlagValue(cmd)
+	log.DbgLogger1.Printf("--output=%v", output)
+
+	allPackages, err := util.ProjectPackages(projectDir)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := util.SelectPackages(allPackages, selector)
+	if err != nil {
+		return err
+	}
+
+	root, err := filepath.Abs(projectDir)
+	if err != nil {
+		return err
+	}
+
+	infos, err := packageInfos(root, allPackages, pkgs)
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case "table":
+		return writePackagesTable(os.Stdout, infos)
+	case "json":
+		var data []interface{}
+		for _, info := range infos {
+			data = append(data, info)
+		}
+
+		return util.OutputData(data, "json", "")
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+}
+
+// packageInfo describes a package in the packages output
+type packageInfo struct {
+	Name     string   `json:"name"`
+	Dir      string   `json:"dir"`
+	Priority uint     `json:"priority"`
+	Tags     []string `json:"tags"`
+	Imported bool     `json:"imported"`
+	Objects  int      `json:"objects"`
+	Files    int      `json:"files"`
+	Selected bool     `json:"selected"`
+}
+
+// packageInfos describes all packages, the project directories are relative to root
+func packageInfos(root string, allPackages, selected util.PackageSlice) ([]*packageInfo, error) {
+	isSelected := make(map[string]bool)
+	for _, pkg := range selected {
+		isSelected[pkg.Name] = true
+	}
+
+	// the inconsistencies are reported by validate
+	ignoreProblem := func(path string, err error) error {
+		return nil
+	}
+
+	var infos []*packageInfo
+	for _, pkg := range allPackages {
+		objects, err := util.ScanProjectObjects(util.PackageSlice{pkg}, ignoreProblem)
+		if err != nil {
+			return nil, err
+		}
+
+		files, err := util.ScanProjectFiles(util.PackageSlice{pkg}, ignoreProblem)
+		if err != nil {
+			return nil, err
+		}
+
+		dir := pkg.Dir
+		if rel, err := filepath.Rel(root, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			dir = rel
+		}
+
+		tags := pkg.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		infos = append(infos, &packageInfo{
+			Name:     pkg.Name,
+			Dir:      dir,
+			Priority: pkg.Priority,
+			Tags:     tags,
+			Imported: pkg.External,
+			Objects:  len(objects),
+			Files:    len(files),
+			Selected: isSelected[pkg.Name],
+		})
+	}
+
+	return infos, nil
+}
+
+func writePackagesTable(w io.Writer, infos []*packageInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tDIR\tPRIORITY\tTAGS\tOBJECTS\tFILES\tSELECTED")
+
+	for _, info := range infos {
+		dir := info.Dir
+		if info.Imported {
+			dir = fmt.Sprintf("%s (imported)", dir)
+		}
+
+		selected := "no"
+		if info.Selected {
+			selected = "yes"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%d\t%s\n", info.Name, dir, info.Priority, strings.Join(info.Tags, ","), info.Objects, info.Files, selected)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,118 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/pflag"
+)
+
+func TestPackagesCmdFlags(t *testing.T) {
+	a := []string{
+		"packages",
+	}
+	cmd, _, err := CmdRoot.Find(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		switch f.Name {
+		case
+			"verbose",
+			"project-dir",
+			"pkg-tags",
+			"pkg-selector",
+			"packages",
+			"output":
+			n++
+		default:
+			t.Errorf("Unknown flag '%v'", f.Name)
+		}
+	})
+
+	expected := 6
+	if n != expected {
+		t.Errorf("Expected '%v' flags, got '%v'", expected, n)
+	}
+}
+
+func TestPackagesTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"base/metadata.json":               `{"priority": 3, "tags": ["shared"]}`,
+		"base/objects/XMLManager/xm1.json": `{"name": "xm1"}`,
+		"base/objects/XMLManager/xm2.json": `{"name": "xm2"}`,
+		"base/files/local/a.xsl":           ``,
+		"prod/metadata.json":               `{"priority": 1, "tags": ["env=prod", "region=eu"], "requires": ["base"]}`,
+		"test/metadata.json":               `{"priority": 2, "tags": ["env=test"]}`,
+	})
+
+	allPackages, err := util.ProjectPackages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr, err := util.ParseSelector("env=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs, err := util.SelectPackages(allPackages, &util.PackageSelector{Expr: expr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := packageInfos(dir, allPackages, pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := writePackagesTable(&b, infos); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"NAME  DIR   PRIORITY  TAGS                OBJECTS  FILES  SELECTED",
+		"prod  prod  1         env=prod,region=eu  0        0      yes",
+		"test  test  2         env=test            0        0      no",
+		"base  base  3         shared              2        1      yes",
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected '%v' lines, got '%v'", len(expected), b.String())
+	}
+
+	for i, l := range lines {
+		if strings.TrimRight(l, " ") != expected[i] {
+			t.Errorf("Expected '%v', got '%v'", expected[i], l)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lfeier/dpctl/deploy"
+	"github.com/lfeier/dpctl/log"
+)
+
+// progressRefresh is the delay between two redraws of the progress view
+var progressRefresh = 250 * time.Millisecond
+
+// maxInFlightLines is the maximum number of in-flight items displayed
+var maxInFlightLines = 5
+
+// progressView draws a live progress block below the item lines of a deploy
+// operation, it is redrawn after each item line and periodically
+type progressView struct {
+	out     io.Writer
+	printer *itemPrinter
+
+	mutex      sync.Mutex
+	phase      deploy.Phase
+	phaseStart time.Time
+	total      int
+	done       int
+	failed     int
+	inFlight   map[string]time.Time
+	lines      int
+	stop       chan struct{}
+	stopped    chan struct{}
+}
+
+func newProgressView(out io.Writer, printer *itemPrinter) *progressView {
+	return &progressView{
+		out:      out,
+		printer:  printer,
+		inFlight: make(map[string]time.Time),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// itemHooks returns the hooks printing the item results of a deploy operation
+// and the function to call once the operation ended; the live progress view is
+// used only when stdout is a terminal and the debug output is disabled
+func itemHooks(resultWidth int) (*deploy.Hooks, func()) {
+	printer := newItemPrinter(resultWidth)
+
+	if log.DebugLevel > 0 || !isTerminal(os.Stdout) {
+		return printer.hooks(), func() {}
+	}
+
+	v := newProgressView(os.Stdout, printer)
+
+	// the log lines, e.g. the item lines, are written above the progress block
+	log.OutLogger.SetOutput(v.writer(os.Stdout))
+	log.ErrLogger.SetOutput(v.writer(os.Stderr))
+
+	go v.run()
+
+	return v.hooks(), func() {
+		v.close()
+
+		log.OutLogger.SetOutput(os.Stdout)
+		log.ErrLogger.SetOutput(os.Stderr)
+	}
+}
+
+// isTerminal reports whether f is a character device
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (v *progressView) hooks() *deploy.Hooks {
+	return &deploy.Hooks{
+		Phase:    v.setPhase,
+		Selected: v.selected,
+		Started:  v.started,
+		Done:     v.itemDone,
+	}
+}
+
+func (v *progressView) run() {
+	defer close(v.stopped)
+
+	ticker := time.NewTicker(progressRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			v.mutex.Lock()
+			v.redraw()
+			v.mutex.Unlock()
+		case <-v.stop:
+			return
+		}
+	}
+}
+
+// close stops the redraws and removes the progress block
+func (v *progressView) close() {
+	close(v.stop)
+	<-v.stopped
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.clear()
+}
+
+func (v *progressView) setPhase(phase deploy.Phase) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.phase = phase
+	v.phaseStart = time.Now()
+	v.total = -1
+	v.done = 0
+	v.failed = 0
+	v.redraw()
+}
+
+func (v *progressView) selected(kind deploy.Kind, items []deploy.Item) {
+	v.printer.selected(kind, items)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.total = len(items)
+	v.phaseStart = time.Now()
+	v.redraw()
+}
+
+func (v *progressView) started(item deploy.Item) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.inFlight[item.Name] = time.Now()
+}
+
+func (v *progressView) itemDone(res *deploy.Result) {
+	v.mutex.Lock()
+
+	delete(v.inFlight, res.Name)
+
+	if res.Kind != deploy.KindDomain {
+		v.done++
+		if res.Status.Failed() {
+			v.failed++
+		}
+	}
+
+	v.mutex.Unlock()
+
+	v.printer.done(res)
+}
+
+// progressWriter writes to a terminal output above the progress block
+type progressWriter struct {
+	v *progressView
+	w io.Writer
+}
+
+// writer returns a writer clearing the progress block before each write to w
+// and redrawing it after
+func (v *progressView) writer(w io.Writer) io.Writer {
+	return &progressWriter{v: v, w: w}
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.v.mutex.Lock()
+	defer pw.v.mutex.Unlock()
+
+	pw.v.clear()
+	n, err := pw.w.Write(p)
+	pw.v.redraw()
+
+	return n, err
+}
+
+// clear erases the progress block, the cursor is left at its first line
+func (v *progressView) clear() {
+	if v.lines > 0 {
+		fmt.Fprintf(v.out, "\x1b[%dA\x1b[J", v.lines)
+		v.lines = 0
+	}
+}
+
+func (v *progressView) redraw() {
+	v.clear()
+
+	lines := v.render(time.Now())
+	for _, l := range lines {
+		fmt.Fprintln(v.out, l)
+	}
+
+	v.lines = len(lines)
+}
+
+// render returns the lines of the progress block
+func (v *progressView) render(now time.Time) []string {
+	if v.phase == "" {
+		return nil
+	}
+
+	elapsed := now.Sub(v.phaseStart)
+
+	if v.total < 0 {
+		return []string{fmt.Sprintf("%s: [%s]", v.phase, elapsed.Truncate(time.Second).String())}
+	}
+
+	status := fmt.Sprintf("%s: %d/%d done, %d failed", v.phase, v.done, v.total, v.failed)
+
+	if v.done > 0 && elapsed > 0 {
+		rate := float64(v.done) / elapsed.Seconds()
+		status = fmt.Sprintf("%s, %.1f/s", status, rate)
+
+		if v.done < v.total {
+			eta := time.Duration(float64(v.total-v.done) / rate * float64(time.Second))
+			status = fmt.Sprintf("%s, ETA %s", status, eta.Truncate(time.Second).String())
+		}
+	}
+
+	lines := []string{status}
+
+	var names []string
+	for name := range v.inFlight {
+		names = append(names, name)
+	}
+
+	// the oldest items first
+	sort.Slice(names, func(i, j int) bool {
+		return v.inFlight[names[i]].Before(v.inFlight[names[j]])
+	})
+
+	for i, name := range names {
+		if i == maxInFlightLines {
+			lines = append(lines, fmt.Sprintf("  ... %d more", len(names)-i))
+			break
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s [%s]", name, now.Sub(v.inFlight[name]).Truncate(time.Second).String()))
+	}
+
+	return lines
+}
@@ -0,0 +1,121 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lfeier/dpctl/deploy"
+)
+
+func TestProgressRender(t *testing.T) {
+	v := newProgressView(&bytes.Buffer{}, newItemPrinter(maxPushResultLength))
+
+	if lines := v.render(time.Now()); len(lines) != 0 {
+		t.Errorf("Expected no lines before the first phase, got '%v'", lines)
+	}
+
+	now := time.Now()
+
+	v.setPhase(deploy.PhaseListFiles)
+	v.phaseStart = now.Add(-61 * time.Second)
+
+	expected := []string{"LISTING FILES: [1m1s]"}
+	if lines := v.render(now); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, lines)
+	}
+
+	v.setPhase(deploy.PhasePullFiles)
+	v.total = 10
+	v.done = 4
+	v.failed = 1
+	v.phaseStart = now.Add(-2 * time.Second)
+	v.inFlight["local/b.xml"] = now.Add(-time.Second)
+	v.inFlight["local/a.xml"] = now.Add(-3 * time.Second)
+
+	expected = []string{
+		"PULLING FILES: 4/10 done, 1 failed, 2.0/s, ETA 3s",
+		"  local/a.xml [3s]",
+		"  local/b.xml [1s]",
+	}
+	if lines := v.render(now); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, lines)
+	}
+}
+
+func TestProgressInFlightLimit(t *testing.T) {
+	v := newProgressView(&bytes.Buffer{}, newItemPrinter(maxPushResultLength))
+
+	v.setPhase(deploy.PhasePushObjects)
+	v.selected(deploy.KindObject, nil)
+
+	now := time.Now()
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		v.inFlight[name] = now
+	}
+
+	lines := v.render(now)
+	if len(lines) != maxInFlightLines+2 {
+		t.Fatalf("Expected '%v' lines, got '%v'", maxInFlightLines+2, lines)
+	}
+
+	expected := "  ... 2 more"
+	if lines[len(lines)-1] != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, lines[len(lines)-1])
+	}
+}
+
+func TestProgressClear(t *testing.T) {
+	out := &bytes.Buffer{}
+	v := newProgressView(out, newItemPrinter(maxPushResultLength))
+
+	v.setPhase(deploy.PhasePushFiles)
+	v.selected(deploy.KindFile, []deploy.Item{{Kind: deploy.KindFile, Name: "local/a.xsl"}})
+	v.started(deploy.Item{Kind: deploy.KindFile, Name: "local/a.xsl"})
+	v.redraw()
+
+	if v.lines != 2 {
+		t.Errorf("Expected '%v' lines, got '%v'", 2, v.lines)
+	}
+
+	out.Reset()
+	v.clear()
+
+	expected := "\x1b[2A\x1b[J"
+	if out.String() != expected {
+		t.Errorf("Expected '%q', got '%q'", expected, out.String())
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	v := newProgressView(out, newItemPrinter(maxPushResultLength))
+
+	v.setPhase(deploy.PhasePushFiles)
+	v.selected(deploy.KindFile, []deploy.Item{{Kind: deploy.KindFile, Name: "local/a.xsl"}})
+
+	out.Reset()
+	if _, err := v.writer(out).Write([]byte("Error: href and value do not match\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "\x1b[1A\x1b[JError: href and value do not match\nPUSHING FILES: 0/1 done, 0 failed\n"
+	if out.String() != expected {
+		t.Errorf("Expected '%q', got '%q'", expected, out.String())
+	}
+}
@@ -15,20 +15,14 @@
 package cmd
 
 import (
-	"context"
 	"errors"
-	"fmt"
-	"net/http"
-	"reflect"
 	"regexp"
 	"strings"
-	"sync/atomic"
-	"time"
 
+	"github.com/lfeier/dpctl/deploy"
 	"github.com/lfeier/dpctl/log"
 	"github.com/lfeier/dpctl/util"
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/semaphore"
 )
 
 func init() {
@@ -50,11 +44,20 @@ func init() {
 	addHTTPTimeoutFlag(scmd)
 	addProjectDirFlag(scmd)
 	addPkgTagsFlag(scmd)
+	addPkgSelectorFlag(scmd)
+	addPackagesFlag(scmd)
 	addObjectsFlag(scmd)
 	addFilesFlag(scmd)
 	addIgnoreObjectsFlag(scmd)
 	addIgnoreFilesFlag(scmd)
 	addParallelFlag(scmd)
+	addGracePeriodFlag(scmd)
+	addCryptoFlag(scmd)
+	addNormalizeFlag(scmd)
+	addIgnorePropertiesFlag(scmd)
+	addSchemaCacheDirFlag(scmd)
+	addRetryFlags(scmd)
+	addThrottleFlags(scmd)
 }
 
 func preRunPull(cmd *cobra.Command, args []string) {
@@ -69,26 +72,13 @@ func runPull(cmd *cobra.Command, args []string) {
 }
 
 func runPullE(cmd *cobra.Command, args []string) error {
-	dpRestMgmtURL, _ := getDPRestMgmtURLFlagValue(cmd)
-	log.DbgLogger1.Printf("--dp-rest-mgmt-url=%v", dpRestMgmtURL)
-
-	dpUserName, _ := getDPUserNameFlagValue(cmd)
-	log.DbgLogger1.Printf("--dp-user-name=%v", dpUserName)
-
-	dpUserPassword, _ := getDPUserPasswordFlagValue(cmd)
-	log.DbgLogger1.Printf("--dp-user-password=%v", "********")
-
-	domain, _ := getDomainFlagValue(cmd)
-	log.DbgLogger1.Printf("--domain=%v", domain)
-
-	httpTimeout, _ := getHTTPTimeoutFlagValue(cmd)
-	log.DbgLogger1.Printf("--http-timeout=%v", httpTimeout)
-
 	projectDir, _ := getProjectDirFlagValue(cmd)
 	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
 
-	pkgTags, _ := getPkgTagsValue(cmd)
-	log.DbgLogger1.Printf("--pkg-tags=%v", pkgTags)
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
 
 	objects, _ := getObjectsFlagValue(cmd)
 	log.DbgLogger1.Printf("--objects=%v", objects)
@@ -105,6 +95,15 @@ func runPullE(cmd *cobra.Command, args []string) error {
 	parallel, _ := getParallelFlagValue(cmd)
 	log.DbgLogger1.Printf("--parallel=%v", parallel)
 
+	gracePeriod, _ := getGracePeriodFlagValue(cmd)
+	log.DbgLogger1.Printf("--grace-period=%v", gracePeriod)
+
+	crypto, _ := getCryptoFlagValue(cmd)
+	log.DbgLogger1.Printf("--crypto=%v", crypto)
+
+	normalize, _ := getNormalizeFlagValue(cmd)
+	log.DbgLogger1.Printf("--normalize=%v", normalize)
+
 	reObjects := regexp.MustCompile(strings.Join(objects, "|"))
 	log.DbgLogger4.Println("objects regexp:", reObjects.String())
 
@@ -127,7 +126,11 @@ func runPullE(cmd *cobra.Command, args []string) error {
 		log.DbgLogger4.Println("  ", *pkg)
 	}
 
-	pkgs := util.FilterPackages(allPackages, pkgTags)
+	pkgs, err := util.SelectPackages(allPackages, selector)
+	if err != nil {
+		return err
+	}
+
 	if len(pkgs) == 0 {
 		return errors.New("no packages selected")
 	}
@@ -137,325 +140,44 @@ func runPullE(cmd *cobra.Command, args []string) error {
 		log.DbgLogger1.Printf("  package: %s (priority %d)", pkg.Name, pkg.Priority)
 	}
 
-	httpClient := util.CreateHTTPClient(httpTimeout)
-
-	sem := semaphore.NewWeighted(int64(parallel))
-
-	err1 := pullFiles(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, reFiles, reIgnoreFiles, pkgs, sem, int64(parallel))
-
-	err2 := pullObjects(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, reObjects, reIgnoreObjects, pkgs, sem, int64(parallel))
-
-	if err1 != nil && err2 != nil {
-		return fmt.Errorf("%s, %s", err1.Error(), err2.Error())
-	}
-
-	if err1 != nil {
-		return err1
-	}
-
-	if err2 != nil {
-		return err2
-	}
-
-	return nil
-}
-
-type pullResult int
-
-const (
-	pullError pullResult = iota
-	pullOK
-	pullNew
-	pullSuccess
-	pullDryRun
-)
-
-func (result *pullResult) String() string {
-	names := [...]string{
-		"ERROR",
-		"OK",
-		"NEW",
-		"SUCCESS",
-		"DRYRUN",
-	}
-
-	return names[*result]
-}
-
-var maxPullResultLength = 7
-
-type logPullFile func(fileInfo *util.FileInfo, result *pullResult, start time.Time)
-type logPullObject func(objectInfo *util.ObjectInfo, result *pullResult, start time.Time)
-
-func pullFiles(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string, reFiles, reIgnoreFiles *regexp.Regexp, pkgs util.PackageSlice, sem *semaphore.Weighted, n int64) error {
-	walkDir := func(path string) error {
-		if reIgnoreFiles.MatchString(path) || reIgnoreFiles.MatchString(fmt.Sprintf("%s/", path)) {
-			log.DbgLogger2.Println("directory ignored:", path)
-			return util.ErrSkipDir
-		}
+	dp := getClientFlagValues(cmd, parallel)
 
-		return nil
+	opts := &deploy.PullOptions{
+		Packages: pkgs,
+		Objects: deploy.Filter{
+			Include: reObjects,
+			Ignore:  reIgnoreObjects,
+		},
+		Files: deploy.Filter{
+			Include: reFiles,
+			Ignore:  reIgnoreFiles,
+		},
+		Parallel:    parallel,
+		GracePeriod: gracePeriod,
+		Crypto:      crypto,
 	}
 
-	var files util.FileInfoSlice
-	maxPathLength := 0
-	maxPkgLength := 0
-	walkFile := func(path string, modified string, size uint) error {
-		if !reFiles.MatchString(path) || reIgnoreFiles.MatchString(path) {
-			log.DbgLogger2.Println("file ignored:", path)
-			return nil
-		}
-
-		pkg, err := util.GetFilePackage(pkgs, path)
-		if err != nil {
-			return err
-		}
-
-		if pkg == nil {
-			pkg = pkgs[0]
-		}
-
-		fileInfo := &util.FileInfo{
-			Path:    path,
-			Package: pkg,
-		}
-
-		files = append(files, fileInfo)
-
-		if maxPathLength < len(path) {
-			maxPathLength = len(path)
-		}
-
-		if maxPkgLength < len(pkg.Name) {
-			maxPkgLength = len(pkg.Name)
-		}
-
-		return nil
-	}
-
-	stores, err := util.GetFileStores(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain)
-	if err != nil {
-		return err
-	}
-
-	for _, store := range stores {
-		if store == "cert" || store == "sharedcert" || store == "pubcert" {
-			log.DbgLogger2.Println("store ignored:", store)
-			continue
-		}
-
-		err = util.WalkFileStore(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, store, walkDir, walkFile)
+	if normalize {
+		opts.Normalizer, err = getNormalizerFlagValues(cmd, dp)
 		if err != nil {
 			return err
 		}
 	}
 
-	logFn := func(fileInfo *util.FileInfo, result *pullResult, start time.Time) {
-		elapsed := time.Since(start)
-		lf := fmt.Sprintf("FILE: %%-%ds [%%s] %%%ds [%%s]", maxPathLength, maxPkgLength+maxPullResultLength-len(fileInfo.Package.Name))
-		log.OutLogger.Printf(lf, fileInfo.Path, fileInfo.Package.Name, result.String(), elapsed.Truncate(time.Millisecond).String())
-	}
-
-	log.DbgLogger1.Printf("files selected: %d", len(files))
-
-	ctx := context.TODO()
-	var errCount uint64
-
-	for _, fileInfo := range files {
-		if err := sem.Acquire(ctx, 1); err != nil {
-			return err
-		}
+	hooks, closeHooks := itemHooks(maxPullResultLength)
+	opts.Hooks = hooks
 
-		go func(fileInfo *util.FileInfo) {
-			defer sem.Release(1)
+	report, err := deploy.Pull(cmdContext, dp, opts)
+	closeHooks()
 
-			if err := pullFile(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, fileInfo, logFn); err != nil {
-				log.ErrLogger.Println("Error:", err.Error())
-				atomic.AddUint64(&errCount, 1)
-			}
-		}(fileInfo)
-	}
+	printReport(report)
 
-	pullWait(ctx, sem, n)
-
-	errCountFinal := atomic.LoadUint64(&errCount)
-	if errCountFinal > 0 {
-		return fmt.Errorf("failed to pull %v files", errCountFinal)
+	if err == deploy.ErrInterrupted {
+		return errors.New("pull interrupted")
 	}
 
-	return nil
+	return err
 }
 
-func pullFile(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string, fileInfo *util.FileInfo, logFn logPullFile) error {
-	result := pullError
-	defer logFn(fileInfo, &result, time.Now())
-
-	data, err := util.GetFile(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, fileInfo.Path)
-	if err != nil {
-		return err
-	}
-
-	f, new, err := util.SaveFile(fileInfo.Package.Dir, fileInfo.Path, data)
-	if err != nil {
-		return err
-	}
-
-	log.DbgLogger4.Println("file local path:", f)
-
-	if new {
-		result = pullNew
-	} else {
-		result = pullOK
-	}
-
-	return nil
-}
-
-func pullObjects(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string, reObjects, reIgnoreObjects *regexp.Regexp, pkgs util.PackageSlice, sem *semaphore.Weighted, n int64) error {
-	res, err := util.GetStatus(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, "ObjectStatus")
-	if err != nil {
-		return err
-	}
-
-	var objects util.ObjectInfoSlice
-	maxQNameLength := 0
-	maxPkgLength := 0
-	for _, objStatus := range util.JSONValue(res, "ObjectStatus").([]interface{}) {
-		name := util.JSONValue(objStatus, "Name").(string)
-		cls := util.JSONValue(objStatus, "Class").(string)
-		qn := util.ObjectQName(cls, name)
-
-		if !reObjects.MatchString(qn) || reIgnoreObjects.MatchString(qn) {
-			log.DbgLogger2.Println("object ignored:", qn)
-			continue
-		}
-
-		pkg, err := util.GetObjectPackage(pkgs, qn)
-		if err != nil {
-			return err
-		}
-
-		if pkg == nil {
-			pkg = pkgs[0]
-		}
-
-		objInfo := &util.ObjectInfo{
-			Name:    name,
-			Class:   cls,
-			Package: pkg,
-		}
-
-		objects = append(objects, objInfo)
-
-		if maxQNameLength < len(qn) {
-			maxQNameLength = len(qn)
-		}
-
-		if maxPkgLength < len(pkg.Name) {
-			maxPkgLength = len(pkg.Name)
-		}
-	}
-
-	logFn := func(objInfo *util.ObjectInfo, result *pullResult, start time.Time) {
-		elapsed := time.Since(start)
-		lf := fmt.Sprintf("OBJECT: %%-%ds [%%s] %%%ds [%%s]", maxQNameLength, maxPkgLength+maxPullResultLength-len(objInfo.Package.Name))
-		log.OutLogger.Printf(lf, objInfo.QName(), objInfo.Package.Name, result.String(), elapsed.Truncate(time.Millisecond).String())
-	}
-
-	log.DbgLogger1.Printf("objects selected: %d", len(objects))
-
-	ctx := context.TODO()
-	var errCount uint64
-
-	for _, objInfo := range objects {
-		if err := sem.Acquire(ctx, 1); err != nil {
-			return err
-		}
-
-		go func(objInfo *util.ObjectInfo) {
-			defer sem.Release(1)
-
-			if err := pullObject(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, objInfo, logFn); err != nil {
-				log.ErrLogger.Println("Error:", err.Error())
-				atomic.AddUint64(&errCount, 1)
-			}
-		}(objInfo)
-	}
-
-	pullWait(ctx, sem, n)
-
-	errCountFinal := atomic.LoadUint64(&errCount)
-	if errCountFinal > 0 {
-		return fmt.Errorf("failed to pull %v objects", errCountFinal)
-	}
-
-	return nil
-}
-
-func pullObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string, objInfo *util.ObjectInfo, logFn logPullObject) error {
-	result := pullError
-	defer logFn(objInfo, &result, time.Now())
-
-	obj, err := util.GetObject(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, objInfo.Class, objInfo.Name)
-	if err != nil && strings.Contains(err.Error(), "HTTP response error: 404 Not Found") {
-		obj, err = util.GetSingletonObject(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, objInfo.Class)
-	}
-	if err != nil {
-		return err
-	}
-
-	name := util.JSONValue(obj, "name").(string)
-	if objInfo.Name != name {
-		objInfo.Name = name
-	}
-
-	updateLinks(obj.(util.GenericMap), domain)
-
-	f, new, err := util.SaveObject(objInfo.Package.Dir, objInfo.QName(), obj)
-	if err != nil {
-		return err
-	}
-
-	log.DbgLogger4.Println("object local path:", f)
-
-	if new {
-		result = pullNew
-	} else {
-		result = pullOK
-	}
-
-	return nil
-}
-
-func updateLinks(o util.GenericMap, domain string) {
-	for k, v := range o {
-		switch k {
-		case "_links":
-			delete(o, k)
-			continue
-		case "href":
-			o[k] = strings.Replace(v.(string), fmt.Sprintf("/mgmt/config/%s/", domain), "/mgmt/config/{domain}/", 1)
-			continue
-		}
-
-		switch reflect.ValueOf(v).Kind() {
-		case reflect.Map:
-			updateLinks(v.(util.GenericMap), domain)
-		case reflect.Slice:
-			for _, sv := range v.([]interface{}) {
-				if reflect.ValueOf(sv).Kind() == reflect.Map {
-					updateLinks(sv.(util.GenericMap), domain)
-				}
-			}
-		}
-	}
-}
-
-func pullWait(ctx context.Context, sem *semaphore.Weighted, n int64) {
-	if err := sem.Acquire(ctx, n); err != nil {
-		log.ErrLogger.Println("Error:", err.Error())
-		return
-	}
-
-	defer sem.Release(n)
-}
+// maxPullResultLength is the length of the longest pull result: NOT-ATTEMPTED
+var maxPullResultLength = 13
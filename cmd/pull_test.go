@@ -41,17 +41,32 @@ func TestPullCmdFlags(t *testing.T) {
 			"http-timeout",
 			"project-dir",
 			"pkg-tags",
+			"pkg-selector",
+			"packages",
 			"objects",
 			"files",
 			"ignore-objects",
-			"ignore-files":
+			"ignore-files",
+			"parallel",
+			"grace-period",
+			"crypto",
+			"normalize",
+			"ignore-properties",
+			"schema-cache-dir",
+			"retry-max-attempts",
+			"retry-backoff",
+			"retry-max-backoff",
+			"retry-status-codes",
+			"rate-limit",
+			"adaptive",
+			"adaptive-max-latency":
 			n++
 		default:
 			t.Errorf("Unknown flag '%v'", f.Name)
 		}
 	})
 
-	expected := 12
+	expected := 27
 	if n != expected {
 		t.Errorf("Expected '%v' flags, got '%v'", expected, n)
 	}
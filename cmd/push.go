@@ -15,20 +15,18 @@
 package cmd
 
 import (
-	"context"
+	"bufio"
 	"errors"
 	"fmt"
-	"net/http"
-	"reflect"
+	"os"
 	"regexp"
 	"strings"
-	"sync/atomic"
 	"time"
 
+	"github.com/lfeier/dpctl/deploy"
 	"github.com/lfeier/dpctl/log"
 	"github.com/lfeier/dpctl/util"
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/semaphore"
 )
 
 func init() {
@@ -50,11 +48,28 @@ func init() {
 	addHTTPTimeoutFlag(scmd)
 	addProjectDirFlag(scmd)
 	addPkgTagsFlag(scmd)
+	addPkgSelectorFlag(scmd)
+	addPackagesFlag(scmd)
 	addObjectsFlag(scmd)
 	addFilesFlag(scmd)
 	addIgnoreObjectsFlag(scmd)
 	addIgnoreFilesFlag(scmd)
 	addParallelFlag(scmd)
+	addGracePeriodFlag(scmd)
+	addCreateDomainFlag(scmd)
+	addDomainTimeoutFlag(scmd)
+	addSchemaFlag(scmd)
+	addSchemaCacheDirFlag(scmd)
+	addCryptoFlag(scmd)
+	addSinceFlag(scmd)
+	addDeleteRemovedFlag(scmd)
+	addWatchFlag(scmd)
+	addDebounceFlag(scmd)
+	addDeleteFilesFlag(scmd)
+	addDeleteEmptyDirsFlag(scmd)
+	addYesFlag(scmd)
+	addRetryFlags(scmd)
+	addThrottleFlags(scmd)
 }
 
 func preRunPush(cmd *cobra.Command, args []string) {
@@ -69,26 +84,13 @@ func runPush(cmd *cobra.Command, args []string) {
 }
 
 func runPushE(cmd *cobra.Command, args []string) error {
-	dpRestMgmtURL, _ := getDPRestMgmtURLFlagValue(cmd)
-	log.DbgLogger1.Printf("--dp-rest-mgmt-url=%v", dpRestMgmtURL)
-
-	dpUserName, _ := getDPUserNameFlagValue(cmd)
-	log.DbgLogger1.Printf("--dp-user-name=%v", dpUserName)
-
-	dpUserPassword, _ := getDPUserPasswordFlagValue(cmd)
-	log.DbgLogger1.Printf("--dp-user-password=%v", "********")
-
-	domain, _ := getDomainFlagValue(cmd)
-	log.DbgLogger1.Printf("--domain=%v", domain)
-
-	httpTimeout, _ := getHTTPTimeoutFlagValue(cmd)
-	log.DbgLogger1.Printf("--http-timeout=%v", httpTimeout)
-
 	projectDir, _ := getProjectDirFlagValue(cmd)
 	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
 
-	pkgTags, _ := getPkgTagsValue(cmd)
-	log.DbgLogger1.Printf("--pkg-tags=%v", pkgTags)
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
 
 	objects, _ := getObjectsFlagValue(cmd)
 	log.DbgLogger1.Printf("--objects=%v", objects)
@@ -105,333 +107,207 @@ func runPushE(cmd *cobra.Command, args []string) error {
 	parallel, _ := getParallelFlagValue(cmd)
 	log.DbgLogger1.Printf("--parallel=%v", parallel)
 
-	reObjects := regexp.MustCompile(strings.Join(objects, "|"))
-	log.DbgLogger4.Println("objects regexp:", reObjects.String())
+	gracePeriod, _ := getGracePeriodFlagValue(cmd)
+	log.DbgLogger1.Printf("--grace-period=%v", gracePeriod)
 
-	reFiles := regexp.MustCompile(strings.Join(files, "|"))
-	log.DbgLogger4.Println("files regexp:", reFiles.String())
+	createDomain, _ := getCreateDomainFlagValue(cmd)
+	log.DbgLogger1.Printf("--create-domain=%v", createDomain)
 
-	reIgnoreObjects := regexp.MustCompile(strings.Join(ignoreObjects, "|"))
-	log.DbgLogger4.Println("ignore objects regexp:", reIgnoreObjects.String())
+	domainTimeout, _ := getDomainTimeoutFlagValue(cmd)
+	log.DbgLogger1.Printf("--domain-timeout=%v", domainTimeout)
 
-	reIgnoreFiles := regexp.MustCompile(strings.Join(ignoreFiles, "|"))
-	log.DbgLogger4.Println("ignore files regexp:", reIgnoreFiles.String())
+	schema, _ := getSchemaFlagValue(cmd)
+	log.DbgLogger1.Printf("--schema=%v", schema)
 
-	allPackages, err := util.ProjectPackages(projectDir)
-	if err != nil {
-		return err
-	}
+	schemaCacheDir, _ := getSchemaCacheDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--schema-cache-dir=%v", schemaCacheDir)
 
-	log.DbgLogger4.Println("all project packages:")
-	for _, pkg := range allPackages {
-		log.DbgLogger4.Println("  ", *pkg)
-	}
+	crypto, _ := getCryptoFlagValue(cmd)
+	log.DbgLogger1.Printf("--crypto=%v", crypto)
 
-	pkgs := util.FilterPackages(allPackages, pkgTags)
-	if len(pkgs) == 0 {
-		return errors.New("no packages selected")
-	}
+	since, _ := getSinceFlagValue(cmd)
+	log.DbgLogger1.Printf("--since=%v", since)
 
-	log.DbgLogger1.Println("packages selected:")
-	for _, pkg := range pkgs {
-		log.DbgLogger1.Printf("  package: %s (priority %d)", pkg.Name, pkg.Priority)
-	}
+	deleteRemoved, _ := getDeleteRemovedFlagValue(cmd)
+	log.DbgLogger1.Printf("--delete-removed=%v", deleteRemoved)
 
-	httpClient := util.CreateHTTPClient(httpTimeout)
+	watch, _ := getWatchFlagValue(cmd)
+	log.DbgLogger1.Printf("--watch=%v", watch)
 
-	sem := semaphore.NewWeighted(int64(parallel))
+	debounce, _ := getDebounceFlagValue(cmd)
+	log.DbgLogger1.Printf("--debounce=%v", debounce)
 
-	err1 := pushFiles(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, reFiles, reIgnoreFiles, pkgs, sem, int64(parallel))
+	deleteFiles, _ := getDeleteFilesFlagValue(cmd)
+	log.DbgLogger1.Printf("--delete-files=%v", deleteFiles)
 
-	err2 := pushObjects(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, reObjects, reIgnoreObjects, pkgs, sem, int64(parallel))
+	deleteEmptyDirs, _ := getDeleteEmptyDirsFlagValue(cmd)
+	log.DbgLogger1.Printf("--delete-empty-dirs=%v", deleteEmptyDirs)
 
-	if err1 != nil && err2 != nil {
-		return fmt.Errorf("%s, %s", err1.Error(), err2.Error())
-	}
+	yes, _ := getYesFlagValue(cmd)
+	log.DbgLogger1.Printf("--yes=%v", yes)
 
-	if err1 != nil {
-		return err1
+	if watch && deleteFiles {
+		return errors.New("--watch and --delete-files are mutually exclusive")
 	}
 
-	if err2 != nil {
-		return err2
+	if watch && since != "" {
+		return errors.New("--watch and --since are mutually exclusive")
 	}
 
-	return nil
-}
-
-type pushResult int
-
-const (
-	pushError pushResult = iota
-	pushOK
-	pushNew
-	pushSuccess
-	pushDryRun
-)
-
-func (result *pushResult) String() string {
-	names := [...]string{
-		"ERROR",
-		"OK",
-		"NEW",
-		"SUCCESS",
-		"DRYRUN",
+	if deleteRemoved && since == "" && !watch {
+		return errors.New("--delete-removed requires --since or --watch")
 	}
 
-	return names[*result]
-}
+	reObjects := regexp.MustCompile(strings.Join(objects, "|"))
+	log.DbgLogger4.Println("objects regexp:", reObjects.String())
+
+	reFiles := regexp.MustCompile(strings.Join(files, "|"))
+	log.DbgLogger4.Println("files regexp:", reFiles.String())
 
-var maxPushResultLength = 7
+	reIgnoreObjects := regexp.MustCompile(strings.Join(ignoreObjects, "|"))
+	log.DbgLogger4.Println("ignore objects regexp:", reIgnoreObjects.String())
 
-type logPushFile func(fileInfo *util.FileInfo, result *pushResult, start time.Time)
-type logPushObject func(objectInfo *util.ObjectInfo, result *pushResult, start time.Time)
+	reIgnoreFiles := regexp.MustCompile(strings.Join(ignoreFiles, "|"))
+	log.DbgLogger4.Println("ignore files regexp:", reIgnoreFiles.String())
 
-func pushFiles(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string, reFiles, reIgnoreFiles *regexp.Regexp, pkgs util.PackageSlice, sem *semaphore.Weighted, n int64) error {
-	files, err := util.GetProjectFiles(pkgs)
+	allPackages, err := util.ProjectPackages(projectDir)
 	if err != nil {
 		return err
 	}
 
-	matchingFiles := files[:0]
-	maxPathLength := 0
-	for _, fileInfo := range files {
-		if !reFiles.MatchString(fileInfo.Path) || reIgnoreFiles.MatchString(fileInfo.Path) {
-			log.DbgLogger2.Println("file ignored:", fileInfo.Path)
-			continue
-		}
-
-		matchingFiles = append(matchingFiles, fileInfo)
-		if maxPathLength < len(fileInfo.Path) {
-			maxPathLength = len(fileInfo.Path)
-		}
-	}
-
-	maxPkgLength := 0
-	for _, pkg := range pkgs {
-		if maxPkgLength < len(pkg.Name) {
-			maxPkgLength = len(pkg.Name)
-		}
-	}
-
-	logFn := func(fileInfo *util.FileInfo, result *pushResult, start time.Time) {
-		elapsed := time.Since(start)
-		lf := fmt.Sprintf("FILE: %%-%ds [%%s] %%%ds [%%s]", maxPathLength, maxPkgLength+maxPushResultLength-len(fileInfo.Package.Name))
-		log.OutLogger.Printf(lf, fileInfo.Path, fileInfo.Package.Name, result.String(), elapsed.Truncate(time.Millisecond).String())
-	}
-
-	log.DbgLogger1.Printf("files selected: %d", len(matchingFiles))
-
-	ctx := context.TODO()
-	var errCount uint64
-
-	for _, fileInfo := range matchingFiles {
-		if err := sem.Acquire(ctx, 1); err != nil {
-			return err
-		}
-
-		go func(fileInfo *util.FileInfo) {
-			defer sem.Release(1)
-			if err := pushFile(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, fileInfo, logFn); err != nil {
-				log.ErrLogger.Println("Error:", err.Error())
-				atomic.AddUint64(&errCount, 1)
-			}
-		}(fileInfo)
-	}
-
-	pushWait(ctx, sem, n)
-
-	errCountFinal := atomic.LoadUint64(&errCount)
-	if errCountFinal > 0 {
-		return fmt.Errorf("failed to push %v files", errCountFinal)
+	log.DbgLogger4.Println("all project packages:")
+	for _, pkg := range allPackages {
+		log.DbgLogger4.Println("  ", *pkg)
 	}
 
-	return nil
-}
-
-func pushFile(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string, fileInfo *util.FileInfo, logFn logPushFile) error {
-	result := pushError
-	defer logFn(fileInfo, &result, time.Now())
-
-	data, err := fileInfo.Data()
+	pkgs, err := util.SelectPackages(allPackages, selector)
 	if err != nil {
 		return err
 	}
 
-	res, err := util.CreateOrUpdateFile(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, fileInfo.Path, data)
-	if err != nil {
-		return err
+	if len(pkgs) == 0 {
+		return errors.New("no packages selected")
 	}
 
-	resStr := util.JSONValue(res, "result").(string)
-	switch {
-	case strings.Contains(resStr, "File was updated"):
-		result = pushOK
-	case strings.Contains(resStr, "File was created"):
-		result = pushNew
-	default:
-		result = pushSuccess
+	log.DbgLogger1.Println("packages selected:")
+	for _, pkg := range pkgs {
+		log.DbgLogger1.Printf("  package: %s (priority %d)", pkg.Name, pkg.Priority)
 	}
 
-	return nil
-}
+	dp := getClientFlagValues(cmd, parallel)
 
-func pushObjects(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string, reObjects, reIgnoreObjects *regexp.Regexp, pkgs util.PackageSlice, sem *semaphore.Weighted, n int64) error {
-	objects, err := util.GetProjectObjects(pkgs)
-	if err != nil {
-		return err
+	opts := &deploy.PushOptions{
+		Packages: pkgs,
+		Objects: deploy.Filter{
+			Include: reObjects,
+			Ignore:  reIgnoreObjects,
+		},
+		Files: deploy.Filter{
+			Include: reFiles,
+			Ignore:  reIgnoreFiles,
+		},
+		Parallel:        parallel,
+		GracePeriod:     gracePeriod,
+		CreateDomain:    createDomain,
+		DomainTimeout:   domainTimeout,
+		Crypto:          crypto,
+		DeleteRemoved:   deleteRemoved,
+		DeleteFiles:     deleteFiles,
+		DeleteEmptyDirs: deleteEmptyDirs,
 	}
 
-	matchingObjects := objects[:0]
-	maxQNameLength := 0
-	for _, objInfo := range objects {
-		qn := objInfo.QName()
-
-		if !reObjects.MatchString(qn) || reIgnoreObjects.MatchString(qn) {
-			log.DbgLogger2.Println("object ignored:", objInfo.QName)
-			continue
-		}
-
-		matchingObjects = append(matchingObjects, objInfo)
-		if maxQNameLength < len(qn) {
-			maxQNameLength = len(qn)
-		}
+	if deleteFiles && !yes {
+		opts.ConfirmDelete = confirmDelete
 	}
 
-	maxPkgLength := 0
-	for _, pkg := range pkgs {
-		if maxPkgLength < len(pkg.Name) {
-			maxPkgLength = len(pkg.Name)
+	if since != "" {
+		opts.Changes, err = util.GitProjectChanges(projectDir, since, pkgs)
+		if err != nil {
+			return err
 		}
-	}
 
-	logFn := func(objInfo *util.ObjectInfo, result *pushResult, start time.Time) {
-		elapsed := time.Since(start)
-		lf := fmt.Sprintf("OBJECT: %%-%ds [%%s] %%%ds [%%s]", maxQNameLength, maxPkgLength+maxPushResultLength-len(objInfo.Package.Name))
-		log.OutLogger.Printf(lf, objInfo.QName(), objInfo.Package.Name, result.String(), elapsed.Truncate(time.Millisecond).String())
+		log.DbgLogger1.Printf("changed since %s: %d objects, %d files", since, len(opts.Changes.Objects), len(opts.Changes.Files))
 	}
 
-	log.DbgLogger1.Printf("objects selected: %d", len(matchingObjects))
-
-	matchingObjects.Sort()
-
-	ctx := context.TODO()
-	var errCount uint64
-
-	for _, objInfo := range matchingObjects {
-		if err := sem.Acquire(ctx, 1); err != nil {
+	if schema {
+		opts.Schema, err = util.NewSchemaRepository(cmdContext, dp, schemaCacheDir)
+		if err != nil {
 			return err
 		}
-
-		go func(objInfo *util.ObjectInfo) {
-			defer sem.Release(1)
-
-			if err := pushObject(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, objInfo, logFn); err != nil {
-				log.ErrLogger.Println("Error:", err.Error())
-				atomic.AddUint64(&errCount, 1)
-			}
-		}(objInfo)
 	}
 
-	pushWait(ctx, sem, n)
-
-	errCountFinal := atomic.LoadUint64(&errCount)
-	if errCountFinal > 0 {
-		return fmt.Errorf("failed to push %v objects", errCountFinal)
+	if watch {
+		return watchPush(dp, opts, debounce)
 	}
 
-	return nil
-}
-
-func pushObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string, objInfo *util.ObjectInfo, logFn logPushObject) error {
-	result := pushError
-	defer logFn(objInfo, &result, time.Now())
-
-	obj, err := objInfo.Data()
-	if err != nil {
-		return err
+	closeHooks := func() {}
+	if opts.ConfirmDelete != nil {
+		// the confirmation prompt cannot share the terminal with the progress view
+		opts.Hooks = newItemPrinter(maxPushResultLength).hooks()
+	} else {
+		opts.Hooks, closeHooks = itemHooks(maxPushResultLength)
 	}
 
-	deleteLinks(obj.(util.GenericMap))
-
-	err = validateObjectName(objInfo.Name, obj)
-	if err != nil {
-		return err
-	}
+	report, err := deploy.Push(cmdContext, dp, opts)
+	closeHooks()
 
-	res, err := util.CreateOrUpdateObject(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, objInfo.Class, obj)
-	if err != nil {
-		errors := util.JSONValue(res, "error")
-		if errors != nil {
-			return fmt.Errorf("%s\n       %v", err.Error(), errors)
-		}
+	printValidationErrors(err)
+	printReport(report)
 
-		return err
+	if err == deploy.ErrInterrupted {
+		return errors.New("push interrupted")
 	}
 
-	resVal := util.JSONValue(res, objInfo.Name)
-	if resVal == nil {
-		resVal = util.JSONValue(res, strings.Replace(objInfo.Name, " ", "_", -1))
-	}
+	return err
+}
 
-	if resVal == nil {
-		return fmt.Errorf("unknown push result")
-	}
+// watchPush pushes the changed items after each burst of changes until interrupted,
+// the results are printed as lines since the pushes never end
+func watchPush(dp util.DataPower, opts *deploy.PushOptions, debounce time.Duration) error {
+	opts.Hooks = newItemPrinter(maxPushResultLength).hooks()
+
+	wopts := &deploy.WatchOptions{
+		Push:     *opts,
+		Debounce: debounce,
+		Watching: func() {
+			log.OutLogger.Printf("Watching %d packages, press Ctrl+C to stop", len(opts.Packages))
+		},
+		Pushed: func(report *deploy.Report, err error) {
+			printValidationErrors(err)
+			printReport(report)
+
+			if err != nil && err != deploy.ErrInterrupted {
+				log.ErrLogger.Println("Error:", err.Error())
+			}
 
-	switch {
-	case strings.Contains(resVal.(string), "Configuration was updated"):
-		result = pushOK
-	case strings.Contains(resVal.(string), "Configuration was created"):
-		result = pushNew
-	default:
-		result = pushSuccess
+			if !report.Interrupted {
+				log.OutLogger.Printf("SUMMARY: %s", report.Summary())
+			}
+		},
 	}
 
-	return nil
+	return deploy.Watch(cmdContext, dp, wopts)
 }
 
-func validateObjectName(name string, obj interface{}) error {
-	n := util.JSONValue(obj, "name")
-	if n == nil || n.(string) == "" {
-		return fmt.Errorf("missing 'name' attribute for object: %s", name)
+// confirmDelete lists the paths and asks on the standard input whether to delete them
+func confirmDelete(paths []string) bool {
+	for _, p := range paths {
+		log.OutLogger.Println("TO DELETE:", p)
 	}
 
-	if name != n {
-		return fmt.Errorf("mismatch: object name: %s, file name: %s", n, name)
-	}
-
-	return nil
-}
-
-func deleteLinks(o util.GenericMap) {
-	for k, v := range o {
-		switch k {
-		case "_links":
-			delete(o, k)
-			continue
-		case "href":
-			delete(o, k)
-			continue
-		}
+	fmt.Printf("Delete %d DataPower files and directories? [y/N] ", len(paths))
 
-		switch reflect.ValueOf(v).Kind() {
-		case reflect.Map:
-			deleteLinks(v.(util.GenericMap))
-		case reflect.Slice:
-			for _, sv := range v.([]interface{}) {
-				if reflect.ValueOf(sv).Kind() == reflect.Map {
-					deleteLinks(sv.(util.GenericMap))
-				}
-			}
-		}
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		log.ErrLogger.Println("No confirmation, use --yes to delete without confirmation")
+		return false
 	}
-}
 
-func pushWait(ctx context.Context, sem *semaphore.Weighted, n int64) {
-	if err := sem.Acquire(ctx, n); err != nil {
-		log.ErrLogger.Println("Error:", err.Error())
-		return
-	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
 
-	defer sem.Release(n)
+	return answer == "y" || answer == "yes"
 }
+
+// maxPushResultLength is the length of the longest push result: DEPENDENCY-FAILED
+var maxPushResultLength = 17
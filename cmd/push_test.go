@@ -41,17 +41,40 @@ func TestPushCmdFlags(t *testing.T) {
 			"http-timeout",
 			"project-dir",
 			"pkg-tags",
+			"pkg-selector",
+			"packages",
 			"objects",
 			"files",
 			"ignore-objects",
-			"ignore-files":
+			"ignore-files",
+			"parallel",
+			"grace-period",
+			"create-domain",
+			"domain-timeout",
+			"schema",
+			"schema-cache-dir",
+			"crypto",
+			"since",
+			"delete-removed",
+			"watch",
+			"debounce",
+			"delete-files",
+			"delete-empty-dirs",
+			"yes",
+			"retry-max-attempts",
+			"retry-backoff",
+			"retry-max-backoff",
+			"retry-status-codes",
+			"rate-limit",
+			"adaptive",
+			"adaptive-max-latency":
 			n++
 		default:
 			t.Errorf("Unknown flag '%v'", f.Name)
 		}
 	})
 
-	expected := 12
+	expected := 35
 	if n != expected {
 		t.Errorf("Expected '%v' flags, got '%v'", expected, n)
 	}
@@ -0,0 +1,123 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lfeier/dpctl/deploy"
+	"github.com/lfeier/dpctl/log"
+)
+
+// itemPrinter prints the item results of a deploy operation in aligned columns
+type itemPrinter struct {
+	// resultWidth is the length of the longest result of the operation
+	resultWidth int
+
+	mutex      sync.Mutex
+	nameWidths map[deploy.Kind]int
+	pkgWidths  map[deploy.Kind]int
+}
+
+func newItemPrinter(resultWidth int) *itemPrinter {
+	return &itemPrinter{
+		resultWidth: resultWidth,
+		nameWidths:  make(map[deploy.Kind]int),
+		pkgWidths:   make(map[deploy.Kind]int),
+	}
+}
+
+func (p *itemPrinter) hooks() *deploy.Hooks {
+	return &deploy.Hooks{
+		Selected: p.selected,
+		Done:     p.done,
+	}
+}
+
+func (p *itemPrinter) selected(kind deploy.Kind, items []deploy.Item) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, item := range items {
+		if p.nameWidths[kind] < len(item.Name) {
+			p.nameWidths[kind] = len(item.Name)
+		}
+
+		if p.pkgWidths[kind] < len(item.Package) {
+			p.pkgWidths[kind] = len(item.Package)
+		}
+	}
+}
+
+func (p *itemPrinter) done(res *deploy.Result) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	elapsed := res.Elapsed.Truncate(time.Millisecond).String()
+
+	if res.Kind == deploy.KindDomain {
+		log.OutLogger.Printf("DOMAIN: %s [%s] [%s]", res.Name, res.Status.String(), elapsed)
+	} else {
+		lf := fmt.Sprintf("%s: %%-%ds [%%s] %%%ds [%%s]", res.Kind.String(), p.nameWidths[res.Kind], p.pkgWidths[res.Kind]+p.resultWidth-len(res.Package))
+		log.OutLogger.Printf(lf, res.Name, res.Package, res.Status.String(), elapsed)
+	}
+
+	if res.Err != nil {
+		log.ErrLogger.Println("Error:", res.Err.Error())
+	}
+}
+
+// printReport prints the unrouted and skipped items, the retries and, for an interrupted
+// operation, the summary
+func printReport(report *deploy.Report) {
+	isUnrouted := func(s deploy.Status) bool {
+		return s == deploy.StatusUnrouted
+	}
+
+	files := report.Count(deploy.KindFile, isUnrouted)
+	objects := report.Count(deploy.KindObject, isUnrouted)
+	if files > 0 || objects > 0 {
+		log.OutLogger.Printf("UNROUTED: %d files, %d objects", files, objects)
+	}
+
+	isSkipped := func(s deploy.Status) bool {
+		return s == deploy.StatusSkipped
+	}
+
+	files = report.Count(deploy.KindFile, isSkipped)
+	objects = report.Count(deploy.KindObject, isSkipped)
+	if files > 0 || objects > 0 {
+		log.OutLogger.Printf("SKIPPED: %d files, %d objects", files, objects)
+	}
+
+	if report.Retries > 0 {
+		log.OutLogger.Printf("RETRIES: %d", report.Retries)
+	}
+
+	if report.Interrupted {
+		log.OutLogger.Printf("SUMMARY: %s", report.Summary())
+	}
+}
+
+// printValidationErrors prints the schema validation errors of a deploy operation
+func printValidationErrors(err error) {
+	if verr, ok := err.(*deploy.ValidationError); ok {
+		for _, err := range verr.Errors {
+			log.ErrLogger.Println("Error:", err.Error())
+		}
+	}
+}
@@ -15,8 +15,15 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +37,16 @@ var CmdRoot = &cobra.Command{
 	Long:  ``,
 }
 
+// cmdContext is cancelled when the commands must stop, e.g. on an interrupt signal
+var cmdContext = context.Background()
+
+// ExecuteContext executes the root command, the commands stop scheduling
+// new requests when ctx is cancelled
+func ExecuteContext(ctx context.Context) error {
+	cmdContext = ctx
+	return CmdRoot.Execute()
+}
+
 func addVerboseFlag(cmd *cobra.Command) {
 	cmd.Flags().CountP("verbose", "v", "verbose mode")
 }
@@ -59,7 +76,15 @@ func addProjectDirFlag(cmd *cobra.Command) {
 }
 
 func addPkgTagsFlag(cmd *cobra.Command) {
-	cmd.Flags().StringSlice("pkg-tags", []string{}, "package selector")
+	cmd.Flags().StringSlice("pkg-tags", []string{}, "tags the selected packages must all have")
+}
+
+func addPkgSelectorFlag(cmd *cobra.Command) {
+	cmd.Flags().String("pkg-selector", "", "package selection expression, e.g. \"env=prod AND (region=eu OR shared) AND NOT experimental\"")
+}
+
+func addPackagesFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("packages", []string{}, "names of the selected packages")
 }
 
 func addObjectsFlag(cmd *cobra.Command) {
@@ -78,10 +103,159 @@ func addIgnoreFilesFlag(cmd *cobra.Command) {
 	cmd.Flags().StringSlice("ignore-files", []string{"^(chkpoints/.*|config/.*|export/.*|image/.*|logstore/.*|logtemp/.*|policyframework/.*|pubcert/.*|sharedcert/.*|store/.*|tasktemplates/.*|temporary/.*)$"}, "ignore files regex filter")
 }
 
+func addIgnoreRefsFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("ignore-refs", []string{"^[^/]+/default$"}, "ignore unresolved references regex filter")
+}
+
+func addSchemaFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("schema", false, "validate objects against the DataPower class metadata")
+}
+
+func addSchemaCacheDirFlag(cmd *cobra.Command) {
+	cmd.Flags().String("schema-cache-dir", defaultSchemaCacheDir(), "class metadata cache directory")
+}
+
+func addOutputFlag(cmd *cobra.Command, value string, usage string) {
+	cmd.Flags().StringP("output", "o", value, usage)
+}
+
+func addFromFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("from", []string{}, "show only the objects reachable from the objects matching the regex filter")
+}
+
+func addToFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("to", []string{}, "show only the objects pointing to the objects matching the regex filter")
+}
+
+func addColorByPackageFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("color-by-package", false, "color the objects by package")
+}
+
+func addRetryMaxAttemptsFlag(cmd *cobra.Command) {
+	cmd.Flags().Int("retry-max-attempts", 3, "maximum number of attempts for idempotent requests")
+}
+
+func addRetryBackoffFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("retry-backoff", time.Duration(1)*time.Second, "delay before the first retry, doubled for each retry")
+}
+
+func addRetryMaxBackoffFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("retry-max-backoff", time.Duration(30)*time.Second, "maximum delay between retries")
+}
+
+func addRetryStatusCodesFlag(cmd *cobra.Command) {
+	cmd.Flags().IntSlice("retry-status-codes", []int{502, 503, 504}, "HTTP status codes to retry")
+}
+
+func addRetryFlags(cmd *cobra.Command) {
+	addRetryMaxAttemptsFlag(cmd)
+	addRetryBackoffFlag(cmd)
+	addRetryMaxBackoffFlag(cmd)
+	addRetryStatusCodesFlag(cmd)
+}
+
+func addRateLimitFlag(cmd *cobra.Command) {
+	cmd.Flags().Float64("rate-limit", 0, "maximum number of requests per second, 0 for no limit")
+}
+
+func addAdaptiveFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("adaptive", false, "adapt the concurrency, up to --parallel, to the appliance latency and error rate")
+}
+
+func addAdaptiveMaxLatencyFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("adaptive-max-latency", time.Duration(5)*time.Second, "request latency above which the adaptive concurrency is lowered")
+}
+
+func addThrottleFlags(cmd *cobra.Command) {
+	addRateLimitFlag(cmd)
+	addAdaptiveFlag(cmd)
+	addAdaptiveMaxLatencyFlag(cmd)
+}
+
+func addGracePeriodFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("grace-period", time.Duration(10)*time.Second, "time given to the requests in progress to complete when interrupted")
+}
+
 func addParallelFlag(cmd *cobra.Command) {
 	cmd.Flags().Int("parallel", 1, "allow parallel execution")
 }
 
+func addCreateDomainFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("create-domain", false, "create the domain if it does not exist")
+}
+
+func addDomainTimeoutFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("domain-timeout", time.Duration(120)*time.Second, "domain startup timeout")
+}
+
+func addCryptoFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("crypto", false, "manage the cert: store, the certificates are exported on pull, the certificates and the keys are uploaded on push")
+}
+
+func addSinceFlag(cmd *cobra.Command) {
+	cmd.Flags().String("since", "", "push only the objects and files changed in the project directory since the git revision, and the objects referencing a changed object")
+}
+
+func addDeleteRemovedFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("delete-removed", false, "with --since, delete the DataPower objects and files removed from the project")
+}
+
+func addWatchFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("watch", false, "watch the package objects and files directories and push the changed items until interrupted")
+}
+
+func addDebounceFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("debounce", time.Duration(500)*time.Millisecond, "with --watch, the quiet period after the last change before pushing")
+}
+
+func addDeleteFilesFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("delete-files", false, "mirror the file stores of the project files, the DataPower files absent from the packages are deleted")
+}
+
+func addDeleteEmptyDirsFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("delete-empty-dirs", false, "with --delete-files, also delete the directories left without files")
+}
+
+func addYesFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("yes", false, "do not ask for confirmation")
+}
+
+func addStateFileFlag(cmd *cobra.Command) {
+	cmd.Flags().String("state-file", "", "file recording the state of the last sync, defaults to .dpctl-sync-<domain>.json in the project directory")
+}
+
+func addConflictsDirFlag(cmd *cobra.Command) {
+	cmd.Flags().String("conflicts-dir", "", "directory receiving the DataPower version of the conflicting items, in the package layout")
+}
+
+func addNormalizeFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("normalize", false, "remove the default valued and the read-only properties from the pulled objects")
+}
+
+func addIgnorePropertiesFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("ignore-properties", []string{}, "properties removed by the normalization, class/property regex filter")
+}
+
+func addCheckFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("check", false, "list the files not formatted without rewriting them, fail if any")
+}
+
+func addParamFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArray("param", []string{}, "action parameter as name=value, repeat for more parameters")
+}
+
+func addInputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("input", "i", "", "JSON file with the action parameters")
+}
+
+func addTemplateFlag(cmd *cobra.Command) {
+	cmd.Flags().String("template", "", "Go template file used to format the output")
+}
+
+func addActionTimeoutFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("action-timeout", time.Duration(300)*time.Second, "maximum time to wait for an asynchronous action to complete")
+}
+
 func getVerboseFlagValue(cmd *cobra.Command) (int, error) {
 	return cmd.Flags().GetCount("verbose")
 }
@@ -114,6 +288,42 @@ func getPkgTagsValue(cmd *cobra.Command) ([]string, error) {
 	return cmd.Flags().GetStringSlice("pkg-tags")
 }
 
+func getPkgSelectorFlagValue(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("pkg-selector")
+}
+
+func getPackagesFlagValue(cmd *cobra.Command) ([]string, error) {
+	return cmd.Flags().GetStringSlice("packages")
+}
+
+// getPackageSelectorFlagValues returns the package selector described by the
+// --pkg-tags, --pkg-selector and --packages flags
+func getPackageSelectorFlagValues(cmd *cobra.Command) (*util.PackageSelector, error) {
+	pkgTags, _ := getPkgTagsValue(cmd)
+	log.DbgLogger1.Printf("--pkg-tags=%v", pkgTags)
+
+	pkgSelector, _ := getPkgSelectorFlagValue(cmd)
+	log.DbgLogger1.Printf("--pkg-selector=%v", pkgSelector)
+
+	packages, _ := getPackagesFlagValue(cmd)
+	log.DbgLogger1.Printf("--packages=%v", packages)
+
+	expr, err := util.ParseSelector(pkgSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	if expr != nil {
+		log.DbgLogger4.Println("package selector:", expr.String())
+	}
+
+	return &util.PackageSelector{
+		Tags:  pkgTags,
+		Expr:  expr,
+		Names: packages,
+	}, nil
+}
+
 func getObjectsFlagValue(cmd *cobra.Command) ([]string, error) {
 	return cmd.Flags().GetStringSlice("objects")
 }
@@ -130,6 +340,242 @@ func getIgnoreFilesFlagValue(cmd *cobra.Command) ([]string, error) {
 	return cmd.Flags().GetStringSlice("ignore-files")
 }
 
+func getIgnoreRefsFlagValue(cmd *cobra.Command) ([]string, error) {
+	return cmd.Flags().GetStringSlice("ignore-refs")
+}
+
+func getSchemaFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("schema")
+}
+
+func getSchemaCacheDirFlagValue(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("schema-cache-dir")
+}
+
+func getOutputFlagValue(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("output")
+}
+
+func getFromFlagValue(cmd *cobra.Command) ([]string, error) {
+	return cmd.Flags().GetStringSlice("from")
+}
+
+func getToFlagValue(cmd *cobra.Command) ([]string, error) {
+	return cmd.Flags().GetStringSlice("to")
+}
+
+func getColorByPackageFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("color-by-package")
+}
+
+func getRetryMaxAttemptsFlagValue(cmd *cobra.Command) (int, error) {
+	return cmd.Flags().GetInt("retry-max-attempts")
+}
+
+func getRetryBackoffFlagValue(cmd *cobra.Command) (time.Duration, error) {
+	return cmd.Flags().GetDuration("retry-backoff")
+}
+
+func getRetryMaxBackoffFlagValue(cmd *cobra.Command) (time.Duration, error) {
+	return cmd.Flags().GetDuration("retry-max-backoff")
+}
+
+func getRetryStatusCodesFlagValue(cmd *cobra.Command) ([]int, error) {
+	return cmd.Flags().GetIntSlice("retry-status-codes")
+}
+
+func getRetryPolicyFlagValues(cmd *cobra.Command) util.RetryPolicy {
+	retryMaxAttempts, _ := getRetryMaxAttemptsFlagValue(cmd)
+	log.DbgLogger1.Printf("--retry-max-attempts=%v", retryMaxAttempts)
+
+	retryBackoff, _ := getRetryBackoffFlagValue(cmd)
+	log.DbgLogger1.Printf("--retry-backoff=%v", retryBackoff)
+
+	retryMaxBackoff, _ := getRetryMaxBackoffFlagValue(cmd)
+	log.DbgLogger1.Printf("--retry-max-backoff=%v", retryMaxBackoff)
+
+	retryStatusCodes, _ := getRetryStatusCodesFlagValue(cmd)
+	log.DbgLogger1.Printf("--retry-status-codes=%v", retryStatusCodes)
+
+	return util.RetryPolicy{
+		MaxAttempts: retryMaxAttempts,
+		Backoff:     retryBackoff,
+		MaxBackoff:  retryMaxBackoff,
+		StatusCodes: retryStatusCodes,
+	}
+}
+
+func getRateLimitFlagValue(cmd *cobra.Command) (float64, error) {
+	return cmd.Flags().GetFloat64("rate-limit")
+}
+
+func getAdaptiveFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("adaptive")
+}
+
+func getAdaptiveMaxLatencyFlagValue(cmd *cobra.Command) (time.Duration, error) {
+	return cmd.Flags().GetDuration("adaptive-max-latency")
+}
+
+// getThrottleFlagValues returns the throttle described by the flags, nil if disabled
+func getThrottleFlagValues(cmd *cobra.Command, parallel int) *util.Throttle {
+	rateLimit, _ := getRateLimitFlagValue(cmd)
+	log.DbgLogger1.Printf("--rate-limit=%v", rateLimit)
+
+	adaptive, _ := getAdaptiveFlagValue(cmd)
+	log.DbgLogger1.Printf("--adaptive=%v", adaptive)
+
+	adaptiveMaxLatency, _ := getAdaptiveMaxLatencyFlagValue(cmd)
+	log.DbgLogger1.Printf("--adaptive-max-latency=%v", adaptiveMaxLatency)
+
+	if rateLimit <= 0 && !adaptive {
+		return nil
+	}
+
+	return util.NewThrottle(rateLimit, adaptive, parallel, adaptiveMaxLatency)
+}
+
+func getGracePeriodFlagValue(cmd *cobra.Command) (time.Duration, error) {
+	return cmd.Flags().GetDuration("grace-period")
+}
+
+// getClientFlagValues creates the DataPower client described by the connection,
+// retry and throttle flags, parallel is the maximum adaptive concurrency
+func getClientFlagValues(cmd *cobra.Command, parallel int) *util.Client {
+	dpRestMgmtURL, _ := getDPRestMgmtURLFlagValue(cmd)
+	log.DbgLogger1.Printf("--dp-rest-mgmt-url=%v", dpRestMgmtURL)
+
+	dpUserName, _ := getDPUserNameFlagValue(cmd)
+	log.DbgLogger1.Printf("--dp-user-name=%v", dpUserName)
+
+	dpUserPassword, _ := getDPUserPasswordFlagValue(cmd)
+	log.DbgLogger1.Printf("--dp-user-password=%v", "********")
+
+	domain, _ := getDomainFlagValue(cmd)
+	log.DbgLogger1.Printf("--domain=%v", domain)
+
+	httpTimeout, _ := getHTTPTimeoutFlagValue(cmd)
+	log.DbgLogger1.Printf("--http-timeout=%v", httpTimeout)
+
+	c := util.NewClient(util.CreateHTTPClient(httpTimeout), dpRestMgmtURL, dpUserName, dpUserPassword, domain)
+	c.RetryPolicy = getRetryPolicyFlagValues(cmd)
+	c.Throttle = getThrottleFlagValues(cmd, parallel)
+
+	return c
+}
+
+// getNormalizerFlagValues returns the normalizer loading the class metadata from dp
+func getNormalizerFlagValues(cmd *cobra.Command, dp util.DataPower) (*util.Normalizer, error) {
+	ignoreProperties, _ := getIgnorePropertiesFlagValue(cmd)
+	log.DbgLogger1.Printf("--ignore-properties=%v", ignoreProperties)
+
+	schemaCacheDir, _ := getSchemaCacheDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--schema-cache-dir=%v", schemaCacheDir)
+
+	schemaRepo, err := util.NewSchemaRepository(cmdContext, dp, schemaCacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	normalizer := &util.Normalizer{Schema: schemaRepo}
+
+	if len(ignoreProperties) > 0 {
+		normalizer.Ignore, err = regexp.Compile(strings.Join(ignoreProperties, "|"))
+		if err != nil {
+			return nil, err
+		}
+
+		log.DbgLogger4.Println("ignore properties regexp:", normalizer.Ignore.String())
+	}
+
+	return normalizer, nil
+}
+
 func getParallelFlagValue(cmd *cobra.Command) (int, error) {
 	return cmd.Flags().GetInt("parallel")
 }
+
+func getCreateDomainFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("create-domain")
+}
+
+func getDomainTimeoutFlagValue(cmd *cobra.Command) (time.Duration, error) {
+	return cmd.Flags().GetDuration("domain-timeout")
+}
+
+func getCryptoFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("crypto")
+}
+
+func getSinceFlagValue(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("since")
+}
+
+func getDeleteRemovedFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("delete-removed")
+}
+
+func getWatchFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("watch")
+}
+
+func getDebounceFlagValue(cmd *cobra.Command) (time.Duration, error) {
+	return cmd.Flags().GetDuration("debounce")
+}
+
+func getDeleteFilesFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("delete-files")
+}
+
+func getDeleteEmptyDirsFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("delete-empty-dirs")
+}
+
+func getYesFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("yes")
+}
+
+func getStateFileFlagValue(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("state-file")
+}
+
+func getConflictsDirFlagValue(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("conflicts-dir")
+}
+
+func getNormalizeFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("normalize")
+}
+
+func getIgnorePropertiesFlagValue(cmd *cobra.Command) ([]string, error) {
+	return cmd.Flags().GetStringSlice("ignore-properties")
+}
+
+func getCheckFlagValue(cmd *cobra.Command) (bool, error) {
+	return cmd.Flags().GetBool("check")
+}
+
+func getParamFlagValue(cmd *cobra.Command) ([]string, error) {
+	return cmd.Flags().GetStringArray("param")
+}
+
+func getInputFlagValue(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("input")
+}
+
+func getTemplateFlagValue(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("template")
+}
+
+func getActionTimeoutFlagValue(cmd *cobra.Command) (time.Duration, error) {
+	return cmd.Flags().GetDuration("action-timeout")
+}
+
+func defaultSchemaCacheDir() string {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(d, "dpctl", "schemas")
+}
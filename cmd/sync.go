@@ -0,0 +1,196 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lfeier/dpctl/deploy"
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var scmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Synchronize DataPower configuration objects and files both ways",
+		Long: `Synchronize DataPower configuration objects and files both ways.
+
+The items changed only in the project since the last sync are pushed, the items
+changed only on DataPower are pulled. The items changed on both sides are listed
+as CONFLICT and left unchanged.`,
+		PreRun: preRunSync,
+		Run:    runSync,
+	}
+
+	CmdRoot.AddCommand(scmd)
+
+	addVerboseFlag(scmd)
+	addDPRestMgmtURLFlag(scmd)
+	addDPUserNameFlag(scmd)
+	addDPUserPasswordFlag(scmd)
+	addDomainFlag(scmd)
+	addHTTPTimeoutFlag(scmd)
+	addProjectDirFlag(scmd)
+	addPkgTagsFlag(scmd)
+	addPkgSelectorFlag(scmd)
+	addPackagesFlag(scmd)
+	addObjectsFlag(scmd)
+	addFilesFlag(scmd)
+	addIgnoreObjectsFlag(scmd)
+	addIgnoreFilesFlag(scmd)
+	addParallelFlag(scmd)
+	addGracePeriodFlag(scmd)
+	addNormalizeFlag(scmd)
+	addIgnorePropertiesFlag(scmd)
+	addSchemaCacheDirFlag(scmd)
+	addStateFileFlag(scmd)
+	addConflictsDirFlag(scmd)
+	addRetryFlags(scmd)
+	addThrottleFlags(scmd)
+}
+
+func preRunSync(cmd *cobra.Command, args []string) {
+	level, _ := getVerboseFlagValue(cmd)
+	log.SetVebosity(level)
+}
+
+func runSync(cmd *cobra.Command, args []string) {
+	if err := runSyncE(cmd, args); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+	}
+}
+
+func runSyncE(cmd *cobra.Command, args []string) error {
+	projectDir, _ := getProjectDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
+
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
+
+	objects, _ := getObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--objects=%v", objects)
+
+	files, _ := getFilesFlagValue(cmd)
+	log.DbgLogger1.Printf("--files=%v", files)
+
+	ignoreObjects, _ := getIgnoreObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--ignore-objects=%v", ignoreObjects)
+
+	ignoreFiles, _ := getIgnoreFilesFlagValue(cmd)
+	log.DbgLogger1.Printf("--ignore-files=%v", ignoreFiles)
+
+	parallel, _ := getParallelFlagValue(cmd)
+	log.DbgLogger1.Printf("--parallel=%v", parallel)
+
+	gracePeriod, _ := getGracePeriodFlagValue(cmd)
+	log.DbgLogger1.Printf("--grace-period=%v", gracePeriod)
+
+	normalize, _ := getNormalizeFlagValue(cmd)
+	log.DbgLogger1.Printf("--normalize=%v", normalize)
+
+	stateFile, _ := getStateFileFlagValue(cmd)
+	log.DbgLogger1.Printf("--state-file=%v", stateFile)
+
+	conflictsDir, _ := getConflictsDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--conflicts-dir=%v", conflictsDir)
+
+	reObjects := regexp.MustCompile(strings.Join(objects, "|"))
+	log.DbgLogger4.Println("objects regexp:", reObjects.String())
+
+	reFiles := regexp.MustCompile(strings.Join(files, "|"))
+	log.DbgLogger4.Println("files regexp:", reFiles.String())
+
+	reIgnoreObjects := regexp.MustCompile(strings.Join(ignoreObjects, "|"))
+	log.DbgLogger4.Println("ignore objects regexp:", reIgnoreObjects.String())
+
+	reIgnoreFiles := regexp.MustCompile(strings.Join(ignoreFiles, "|"))
+	log.DbgLogger4.Println("ignore files regexp:", reIgnoreFiles.String())
+
+	allPackages, err := util.ProjectPackages(projectDir)
+	if err != nil {
+		return err
+	}
+
+	log.DbgLogger4.Println("all project packages:")
+	for _, pkg := range allPackages {
+		log.DbgLogger4.Println("  ", *pkg)
+	}
+
+	pkgs, err := util.SelectPackages(allPackages, selector)
+	if err != nil {
+		return err
+	}
+
+	if len(pkgs) == 0 {
+		return errors.New("no packages selected")
+	}
+
+	log.DbgLogger1.Println("packages selected:")
+	for _, pkg := range pkgs {
+		log.DbgLogger1.Printf("  package: %s (priority %d)", pkg.Name, pkg.Priority)
+	}
+
+	dp := getClientFlagValues(cmd, parallel)
+
+	if stateFile == "" {
+		domain, _ := getDomainFlagValue(cmd)
+		stateFile = filepath.Join(projectDir, fmt.Sprintf(".dpctl-sync-%s.json", domain))
+	}
+
+	opts := &deploy.SyncOptions{
+		Packages: pkgs,
+		Objects: deploy.Filter{
+			Include: reObjects,
+			Ignore:  reIgnoreObjects,
+		},
+		Files: deploy.Filter{
+			Include: reFiles,
+			Ignore:  reIgnoreFiles,
+		},
+		Parallel:     parallel,
+		GracePeriod:  gracePeriod,
+		StateFile:    stateFile,
+		ConflictsDir: conflictsDir,
+	}
+
+	if normalize {
+		opts.Normalizer, err = getNormalizerFlagValues(cmd, dp)
+		if err != nil {
+			return err
+		}
+	}
+
+	hooks, closeHooks := itemHooks(maxPushResultLength)
+	opts.Hooks = hooks
+
+	report, err := deploy.Sync(cmdContext, dp, opts)
+	closeHooks()
+
+	printReport(report)
+
+	if err == deploy.ErrInterrupted {
+		return errors.New("sync interrupted")
+	}
+
+	return err
+}
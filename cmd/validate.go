@@ -0,0 +1,254 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var scmd = &cobra.Command{
+		Use:    "validate",
+		Short:  "Validate the project consistency",
+		Long:   ``,
+		PreRun: preRunValidate,
+		Run:    runValidate,
+	}
+
+	CmdRoot.AddCommand(scmd)
+
+	addVerboseFlag(scmd)
+	addDPRestMgmtURLFlag(scmd)
+	addDPUserNameFlag(scmd)
+	addDPUserPasswordFlag(scmd)
+	addDomainFlag(scmd)
+	addHTTPTimeoutFlag(scmd)
+	addProjectDirFlag(scmd)
+	addPkgTagsFlag(scmd)
+	addPkgSelectorFlag(scmd)
+	addPackagesFlag(scmd)
+	addObjectsFlag(scmd)
+	addIgnoreObjectsFlag(scmd)
+	addIgnoreRefsFlag(scmd)
+	addSchemaFlag(scmd)
+	addSchemaCacheDirFlag(scmd)
+	addRetryFlags(scmd)
+}
+
+func preRunValidate(cmd *cobra.Command, args []string) {
+	level, _ := getVerboseFlagValue(cmd)
+	log.SetVebosity(level)
+}
+
+func runValidate(cmd *cobra.Command, args []string) {
+	if err := runValidateE(cmd, args); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func runValidateE(cmd *cobra.Command, args []string) error {
+	projectDir, _ := getProjectDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--project-dir=%v", projectDir)
+
+	selector, err := getPackageSelectorFlagValues(cmd)
+	if err != nil {
+		return err
+	}
+
+	objects, _ := getObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--objects=%v", objects)
+
+	ignoreObjects, _ := getIgnoreObjectsFlagValue(cmd)
+	log.DbgLogger1.Printf("--ignore-objects=%v", ignoreObjects)
+
+	ignoreRefs, _ := getIgnoreRefsFlagValue(cmd)
+	log.DbgLogger1.Printf("--ignore-refs=%v", ignoreRefs)
+
+	schema, _ := getSchemaFlagValue(cmd)
+	log.DbgLogger1.Printf("--schema=%v", schema)
+
+	schemaCacheDir, _ := getSchemaCacheDirFlagValue(cmd)
+	log.DbgLogger1.Printf("--schema-cache-dir=%v", schemaCacheDir)
+
+	reObjects := regexp.MustCompile(strings.Join(objects, "|"))
+	log.DbgLogger4.Println("objects regexp:", reObjects.String())
+
+	reIgnoreObjects := regexp.MustCompile(strings.Join(ignoreObjects, "|"))
+	log.DbgLogger4.Println("ignore objects regexp:", reIgnoreObjects.String())
+
+	reIgnoreRefs := regexp.MustCompile(strings.Join(ignoreRefs, "|"))
+	log.DbgLogger4.Println("ignore refs regexp:", reIgnoreRefs.String())
+
+	allPackages, err := util.ProjectPackages(projectDir)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := util.SelectPackages(allPackages, selector)
+	if err != nil {
+		return err
+	}
+
+	if len(pkgs) == 0 {
+		return errors.New("no packages selected")
+	}
+
+	log.DbgLogger1.Println("packages selected:")
+	for _, pkg := range pkgs {
+		log.DbgLogger1.Printf("  package: %s (priority %d)", pkg.Name, pkg.Priority)
+	}
+
+	var schemaRepo *util.SchemaRepository
+	if schema {
+		dp := getClientFlagValues(cmd, 1)
+
+		schemaRepo, err = util.NewSchemaRepository(cmdContext, dp, schemaCacheDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	problems, err := validateProject(pkgs, reObjects, reIgnoreObjects, reIgnoreRefs, schemaRepo)
+	if err != nil {
+		return err
+	}
+
+	root, err := filepath.Abs(projectDir)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		path := p.path
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = rel
+		}
+
+		log.OutLogger.Printf("%s: %s", path, p.msg)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+
+	return nil
+}
+
+type validateProblem struct {
+	path string
+	msg  string
+}
+
+type validateProblemSlice []*validateProblem
+
+func (s validateProblemSlice) Len() int {
+	return len(s)
+}
+
+func (s validateProblemSlice) Less(i, j int) bool {
+	if s[i].path != s[j].path {
+		return s[i].path < s[j].path
+	}
+
+	return s[i].msg < s[j].msg
+}
+
+func (s validateProblemSlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func validateProject(pkgs util.PackageSlice, reObjects, reIgnoreObjects, reIgnoreRefs *regexp.Regexp, schemaRepo *util.SchemaRepository) (validateProblemSlice, error) {
+	var problems validateProblemSlice
+
+	addProblem := func(path string, err error) error {
+		problems = append(problems, &validateProblem{path: path, msg: err.Error()})
+		return nil
+	}
+
+	objects, err := util.ScanProjectObjects(pkgs, addProblem)
+	if err != nil {
+		return nil, err
+	}
+
+	qns := make(map[string]bool)
+	for _, objInfo := range objects {
+		qns[objInfo.QName()] = true
+	}
+
+	for _, objInfo := range objects {
+		qn := objInfo.QName()
+
+		if !reObjects.MatchString(qn) || reIgnoreObjects.MatchString(qn) {
+			log.DbgLogger2.Println("object ignored:", qn)
+			continue
+		}
+
+		obj, err := objInfo.Data()
+		if err != nil {
+			addProblem(objInfo.File, err)
+			continue
+		}
+
+		if _, ok := obj.(util.GenericMap); !ok {
+			addProblem(objInfo.File, errors.New("object file must contain a JSON object"))
+			continue
+		}
+
+		if err := util.ValidateObjectName(objInfo.Name, obj); err != nil {
+			addProblem(objInfo.File, err)
+		}
+
+		for _, err := range util.RefErrors(obj) {
+			addProblem(objInfo.File, err)
+		}
+
+		depend, _ := objInfo.Depend()
+		for _, d := range depend {
+			if !qns[d] && !reIgnoreRefs.MatchString(d) {
+				addProblem(objInfo.File, fmt.Errorf("unresolved reference: %s", d))
+			}
+		}
+
+		if schemaRepo != nil {
+			errs, err := schemaRepo.ValidateObject(objInfo.Class, obj)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, err := range errs {
+				addProblem(objInfo.File, err)
+			}
+		}
+	}
+
+	if _, err := util.ScanProjectFiles(pkgs, addProblem); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(problems)
+
+	return problems, nil
+}
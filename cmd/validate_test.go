@@ -0,0 +1,133 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+	"github.com/lfeier/dpctl/util"
+	"github.com/spf13/pflag"
+)
+
+func TestValidateCmdFlags(t *testing.T) {
+	a := []string{
+		"validate",
+	}
+	cmd, _, err := CmdRoot.Find(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		switch f.Name {
+		case
+			"verbose",
+			"dp-rest-mgmt-url",
+			"dp-user-name",
+			"dp-user-password",
+			"domain",
+			"http-timeout",
+			"project-dir",
+			"pkg-tags",
+			"pkg-selector",
+			"packages",
+			"objects",
+			"ignore-objects",
+			"ignore-refs",
+			"schema",
+			"schema-cache-dir",
+			"retry-max-attempts",
+			"retry-backoff",
+			"retry-max-backoff",
+			"retry-status-codes":
+			n++
+		default:
+			t.Errorf("Unknown flag '%v'", f.Name)
+		}
+	})
+
+	expected := 19
+	if n != expected {
+		t.Errorf("Expected '%v' flags, got '%v'", expected, n)
+	}
+}
+
+func TestValidateProject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"pkg1/metadata.json":                       `{"priority": 1}`,
+		"pkg1/objects/XMLManager/xm1.json":         `{"name": "xm1"}`,
+		"pkg1/objects/XMLManager/xm2.json":         `{"name": "other"}`,
+		"pkg1/objects/StylePolicy/sp1.json":        `{"name": "sp1", "XMLManager": {"value": "xm3", "href": "/mgmt/config/{domain}/XMLManager/xm3"}}`,
+		"pkg1/objects/StylePolicy/sp2.json":        `{"name": "sp2", "XMLManager": {"value": "xm1", "href": "/mgmt/config/{domain}/XMLManager/xm2"}}`,
+		"pkg1/objects/StylePolicy/sp3.json":        `{"name": "sp3", "XMLManager": {"value": "default", "href": "/mgmt/config/{domain}/XMLManager/default"}}`,
+		"pkg1/objects/StylePolicy/sp4.json":        `{"name": "sp4",`,
+		"pkg1/objects/stray.json":                  `{}`,
+		"pkg1/files/stray.xsl":                     ``,
+		"pkg1/files/local/ok.xsl":                  ``,
+		"pkg2/metadata.json":                       `{"priority": 2}`,
+		"pkg2/objects/StylePolicy/sp5.json":        `{"name": "sp5", "XMLManager": {"value": "xm1", "href": "/mgmt/config/{domain}/XMLManager/xm1"}}`,
+		"pkg2/objects/StylePolicy/nested/sp6.json": `{"name": "sp6"}`,
+		"pkg2/objects/XMLManager/xm4.patch.json":   `{"CacheSize": 10}`,
+	})
+
+	pkgs, err := util.ProjectPackages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := validateProject(pkgs, regexp.MustCompile(".*"), regexp.MustCompile("^.*/__.*__$"), regexp.MustCompile("^[^/]+/default$"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"pkg1/files/stray.xsl: unexpected package file",
+		"pkg1/objects/StylePolicy/sp1.json: unresolved reference: XMLManager/xm3",
+		"pkg1/objects/StylePolicy/sp2.json: href and value do not match",
+		"pkg1/objects/StylePolicy/sp4.json: unexpected end of JSON input",
+		"pkg1/objects/XMLManager/xm2.json: mismatch: object name: other, file name: xm2",
+		"pkg1/objects/stray.json: unexpected package file",
+		"pkg2/objects/StylePolicy/nested: unexpected package directory",
+		"pkg2/objects/XMLManager/xm4.patch.json: patch target object not found: XMLManager/xm4",
+	}
+
+	if len(problems) != len(expected) {
+		for _, p := range problems {
+			t.Log(p.path, p.msg)
+		}
+		t.Fatalf("Expected '%v' problems, got '%v'", len(expected), len(problems))
+	}
+
+	for i, p := range problems {
+		rel, _ := filepath.Rel(dir, p.path)
+		s := filepath.ToSlash(rel) + ": " + p.msg
+		if !strings.HasPrefix(s, expected[i]) {
+			t.Errorf("Expected '%v', got '%v'", expected[i], s)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+)
+
+// ActionPollInterval is the delay between two asynchronous action status checks
+var ActionPollInterval = time.Second
+
+// ExecuteAction executes an action and waits for the asynchronous actions to complete,
+// the returned response has no links
+func ExecuteAction(ctx context.Context, dp util.DataPower, name string, params util.GenericMap, timeout time.Duration) (interface{}, error) {
+	res, err := dp.ExecuteAction(ctx, name, params)
+	if err != nil {
+		return nil, err
+	}
+
+	href, _ := util.JSONValue(res, "_links", "location", "href").(string)
+	if href == "" {
+		deleteActionLinks(res)
+		return res, nil
+	}
+
+	log.DbgLogger1.Println("action status location:", href)
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		select {
+		case <-time.After(ActionPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		res, err := dp.GetActionStatus(ctx, href)
+		if err != nil {
+			return nil, err
+		}
+
+		status, _ := util.JSONValue(res, "status").(string)
+		log.DbgLogger2.Printf("action %s is %s", name, status)
+
+		switch status {
+		case "completed":
+			deleteActionLinks(res)
+			return res, nil
+		case "error", "failed":
+			deleteActionLinks(res)
+			return res, fmt.Errorf("action %s failed", name)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("action %s not completed after %v", name, timeout)
+		}
+	}
+}
+
+func deleteActionLinks(res interface{}) {
+	if m, ok := res.(util.GenericMap); ok {
+		delete(m, "_links")
+	}
+}
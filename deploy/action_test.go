@@ -0,0 +1,94 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lfeier/dpctl/dptest"
+	"github.com/lfeier/dpctl/util"
+)
+
+func TestExecuteAction(t *testing.T) {
+	ts := dptest.NewServer("admin", "secret")
+	defer ts.Close()
+
+	ts.AddDomain("d")
+
+	var received util.GenericMap
+	ts.SetAction("FlushDocumentCache", func(domain string, params util.GenericMap) (interface{}, error) {
+		received = params
+		return "Operation completed.", nil
+	})
+
+	params := util.GenericMap{"XMLManager": "xm"}
+	res, err := ExecuteAction(context.Background(), ts.NewClient("d"), "FlushDocumentCache", params, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := util.GenericMap{"FlushDocumentCache": "Operation completed."}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, res)
+	}
+
+	if !reflect.DeepEqual(received, params) {
+		t.Errorf("Expected '%v', got '%v'", params, received)
+	}
+}
+
+func TestExecuteAsyncAction(t *testing.T) {
+	defer func(d time.Duration) { ActionPollInterval = d }(ActionPollInterval)
+	ActionPollInterval = time.Millisecond
+
+	ts := dptest.NewServer("admin", "secret")
+	defer ts.Close()
+
+	ts.AddDomain("d")
+	ts.SetAsyncAction("CreateCheckpoint", 2, func(domain string, params util.GenericMap) (interface{}, error) {
+		return "Checkpoint created.", nil
+	})
+	ts.SetAsyncAction("TestConnection", 0, func(domain string, params util.GenericMap) (interface{}, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	dp := ts.NewClient("d")
+
+	res, err := ExecuteAction(context.Background(), dp, "CreateCheckpoint", nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := util.GenericMap{"status": "completed", "result": "Checkpoint created."}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, res)
+	}
+
+	if _, err := ExecuteAction(context.Background(), dp, "TestConnection", nil, time.Second); err == nil {
+		t.Errorf("Expected the action to fail")
+	}
+
+	ts.SetAsyncAction("Quiesce", 1000, func(domain string, params util.GenericMap) (interface{}, error) {
+		return "Quiesced.", nil
+	})
+
+	if _, err := ExecuteAction(context.Background(), dp, "Quiesce", nil, 10*time.Millisecond); err == nil {
+		t.Errorf("Expected the action to time out")
+	}
+}
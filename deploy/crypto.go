@@ -0,0 +1,301 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"golang.org/x/sync/semaphore"
+)
+
+// certStore is the file store of the domain certificates and keys, the shared
+// and the public certificate stores are never managed
+const certStore = "cert"
+
+// CryptoExportTimeout is the maximum time to wait for a certificate export
+var CryptoExportTimeout = time.Minute
+
+// isCertFile reports whether the file is in the cert: store
+func isCertFile(path string) bool {
+	return strings.HasPrefix(path, certStore+"/")
+}
+
+// isCryptoClass reports whether the objects of the class reference a cert: store file
+func isCryptoClass(cls string) bool {
+	return cls == "CryptoCertificate" || cls == "CryptoKey"
+}
+
+// cryptoFile returns the file store path of the file referenced by a crypto
+// object, e.g. cert:///a.pem is cert/a.pem; empty if not a file URL
+func cryptoFile(obj interface{}) string {
+	url, _ := util.JSONValue(obj, "Filename").(string)
+
+	i := strings.Index(url, ":///")
+	if i <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%s", url[:i], url[i+4:])
+}
+
+// failedCryptoFile returns the file referenced by a crypto object that failed to push
+func failedCryptoFile(objInfo *util.ObjectInfo, failedFiles map[string]bool) string {
+	if !isCryptoClass(objInfo.Class) {
+		return ""
+	}
+
+	obj, err := objInfo.Data()
+	if err != nil {
+		return ""
+	}
+
+	if f := cryptoFile(obj); failedFiles[f] {
+		return f
+	}
+
+	return ""
+}
+
+// certificatePEM returns the PEM certificate of a crypto export output
+func certificatePEM(data []byte) ([]byte, error) {
+	var export struct {
+		Certificate string `xml:"certificate"`
+	}
+
+	if err := xml.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+
+	b64 := strings.Join(strings.Fields(export.Certificate), "")
+	if b64 == "" {
+		return nil, errors.New("no certificate found in the crypto export")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// exportCertificate exports the public certificate of a CryptoCertificate object in PEM format
+func exportCertificate(ctx context.Context, dp util.DataPower, name string) ([]byte, error) {
+	out := fmt.Sprintf("dpctl-%s.xml", name)
+
+	params := util.GenericMap{
+		"ObjectType":     "cert",
+		"ObjectName":     name,
+		"OutputFilename": out,
+	}
+
+	path := fmt.Sprintf("temporary/%s", out)
+
+	// the export file is deleted whether or not it was read
+	defer func() {
+		if err := dp.DeleteFile(ctx, path); err != nil && !util.IsNotFound(err) {
+			log.DbgLogger1.Printf("export file %s not deleted: %v", path, err)
+		}
+	}()
+
+	if _, err := ExecuteAction(ctx, dp, "CryptoExport", params, CryptoExportTimeout); err != nil {
+		return nil, err
+	}
+
+	data, err := dp.GetFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return certificatePEM(data)
+}
+
+// certExport is a cert: store file with the certificate object exporting it, if any
+type certExport struct {
+	fileInfo *util.FileInfo
+	object   string
+}
+
+// remoteCertFiles lists the cert: store files matching the filter, the certificates
+// are paired with the CryptoCertificate objects matching the objects filter
+func remoteCertFiles(ctx context.Context, dp util.DataPower, objFilter, fileFilter Filter, pkgs util.PackageSlice) ([]*certExport, error) {
+	exports := make(map[string]*certExport)
+
+	walkFile := func(path string, modified string, size uint) error {
+		if !fileFilter.Match(path) {
+			log.DbgLogger2.Println("file ignored:", path)
+			return nil
+		}
+
+		exports[path] = &certExport{fileInfo: &util.FileInfo{Path: path}}
+		return nil
+	}
+
+	walkDir := func(path string) error {
+		return nil
+	}
+
+	if err := dp.WalkFileStore(ctx, certStore, walkDir, walkFile); err != nil {
+		return nil, err
+	}
+
+	certs, err := dp.GetObjects(ctx, "CryptoCertificate")
+	if err != nil && !util.IsNotFound(err) {
+		return nil, err
+	}
+
+	for _, cert := range certs {
+		name := util.JSONValue(cert, "name").(string)
+		qn := util.ObjectQName("CryptoCertificate", name)
+
+		path := cryptoFile(cert)
+		if !isCertFile(path) || !objFilter.Match(qn) || !fileFilter.Match(path) {
+			log.DbgLogger2.Println("certificate ignored:", qn)
+			continue
+		}
+
+		e, ok := exports[path]
+		if !ok {
+			e = &certExport{fileInfo: &util.FileInfo{Path: path}}
+			exports[path] = e
+		}
+
+		e.object = name
+	}
+
+	var res []*certExport
+	for _, e := range exports {
+		pkg, err := util.GetFilePackage(pkgs, e.fileInfo.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if pkg == nil {
+			if pkg, err = routeFile(pkgs, e.fileInfo.Path); err != nil {
+				return nil, err
+			}
+		}
+
+		e.fileInfo.Package = pkg
+		res = append(res, e)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].fileInfo.Path < res[j].fileInfo.Path
+	})
+
+	return res, nil
+}
+
+// pullCrypto saves the certificates exported from the CryptoCertificate objects, the
+// other cert: store files, e.g. the private keys, cannot be pulled and are only inventoried
+func pullCrypto(ctx, rctx context.Context, dp util.DataPower, objFilter, fileFilter Filter, pkgs util.PackageSlice, sem *semaphore.Weighted, n int64, report *Report) error {
+	report.phase(PhaseListCrypto)
+
+	exports, err := remoteCertFiles(ctx, dp, objFilter, fileFilter, pkgs)
+	if err != nil {
+		return err
+	}
+
+	report.phase(PhasePullCrypto)
+
+	var items []Item
+	for _, e := range exports {
+		items = append(items, fileItem(e.fileInfo))
+	}
+
+	log.DbgLogger1.Printf("certificate store files selected: %d", len(exports))
+	report.selected(KindFile, items)
+
+	var errCount uint64
+
+	for i, e := range exports {
+		switch {
+		case e.object == "":
+			report.add(fileItem(e.fileInfo), StatusInventoried, nil, time.Now())
+			continue
+		case e.fileInfo.Package == nil:
+			log.DbgLogger1.Println("file not routed:", e.fileInfo.Path)
+			report.add(fileItem(e.fileInfo), StatusUnrouted, nil, time.Now())
+			continue
+		case e.fileInfo.Package.External:
+			log.DbgLogger1.Println("file imported:", e.fileInfo.Path)
+			report.add(fileItem(e.fileInfo), StatusSkipped, nil, time.Now())
+			continue
+		}
+
+		if err := acquireItem(ctx, sem); err != nil {
+			for _, e := range exports[i:] {
+				report.add(fileItem(e.fileInfo), StatusNotAttempted, nil, time.Now())
+			}
+
+			break
+		}
+
+		go func(e *certExport) {
+			defer sem.Release(1)
+
+			report.started(fileItem(e.fileInfo))
+
+			start := time.Now()
+			status, err := pullCertificate(rctx, dp, e)
+			if err != nil {
+				atomic.AddUint64(&errCount, 1)
+			}
+
+			report.add(fileItem(e.fileInfo), status, err, start)
+		}(e)
+	}
+
+	waitItems(sem, n)
+
+	errCountFinal := atomic.LoadUint64(&errCount)
+	if errCountFinal > 0 {
+		return fmt.Errorf("failed to export %v certificates", errCountFinal)
+	}
+
+	return nil
+}
+
+func pullCertificate(ctx context.Context, dp util.DataPower, e *certExport) (Status, error) {
+	data, err := exportCertificate(ctx, dp, e.object)
+	if err != nil {
+		return StatusError, err
+	}
+
+	f, new, err := util.SaveFile(e.fileInfo.Package.Dir, e.fileInfo.Path, data)
+	if err != nil {
+		return StatusError, err
+	}
+
+	log.DbgLogger4.Println("certificate local path:", f)
+
+	if new {
+		return StatusNew, nil
+	}
+
+	return StatusOK, nil
+}
@@ -0,0 +1,179 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+)
+
+// deleteRemoved deletes the DataPower objects then the files removed from the project,
+// the items still provided by another package are kept
+func deleteRemoved(ctx, rctx context.Context, dp util.DataPower, opts *PushOptions, report *Report) error {
+	objects, err := util.GetProjectObjects(opts.Packages)
+	if err != nil {
+		return err
+	}
+
+	inProject := make(map[string]bool)
+	for _, objInfo := range objects {
+		inProject[objInfo.QName()] = true
+	}
+
+	files, err := util.GetProjectFiles(opts.Packages)
+	if err != nil {
+		return err
+	}
+
+	for _, fileInfo := range files {
+		inProject[fileInfo.Path] = true
+	}
+
+	var removedObjects util.ObjectInfoSlice
+	for qn := range opts.Changes.RemovedObjects {
+		if !inProject[qn] && opts.Objects.Match(qn) {
+			cls, name := splitQName(qn)
+			removedObjects = append(removedObjects, util.NewObjectInfo(cls, name, opts.Changes.RemovedData[qn]))
+		}
+	}
+
+	var removedFiles []Item
+	for path := range opts.Changes.RemovedFiles {
+		if inProject[path] || !opts.Files.Match(path) || (!opts.Crypto && isCertFile(path)) {
+			continue
+		}
+
+		removedFiles = append(removedFiles, Item{Kind: KindFile, Name: path})
+	}
+
+	return deleteRemote(ctx, rctx, dp, removedObjects, removedFiles, report)
+}
+
+// deleteRemote deletes the DataPower objects, the referrers before the objects they
+// reference, then the files
+func deleteRemote(ctx, rctx context.Context, dp util.DataPower, objects util.ObjectInfoSlice, files []Item, report *Report) error {
+	items, err := deleteOrder(objects)
+	if err != nil {
+		return err
+	}
+
+	sortItems(files)
+
+	return deleteAll(ctx, PhaseDeleteObjects, items, PhaseDeleteFiles, files, func(item Item) error {
+		if item.Kind == KindFile {
+			return dp.DeleteFile(rctx, item.Name)
+		}
+
+		cls, name := splitQName(item.Name)
+		return dp.DeleteObject(rctx, cls, name)
+	}, report)
+}
+
+// deleteOrder returns the items of the objects in deletion order, DataPower refuses
+// to delete a referenced object so the dependency levels are reversed
+func deleteOrder(objects util.ObjectInfoSlice) ([]Item, error) {
+	levels, err := util.NewObjectGraph(objects).Levels()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	for i := len(levels) - 1; i >= 0; i-- {
+		for _, objInfo := range levels[i] {
+			items = append(items, Item{Kind: KindObject, Name: objInfo.QName()})
+		}
+	}
+
+	return items, nil
+}
+
+// sortItems sorts the items by name
+func sortItems(items []Item) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+}
+
+// deleteAll deletes the objects then the files, each in order and in its phase
+func deleteAll(ctx context.Context, objectsPhase Phase, objects []Item, filesPhase Phase, files []Item, deleteFn func(item Item) error, report *Report) error {
+	report.phase(objectsPhase)
+
+	err1 := deleteItems(ctx, objects, deleteFn, report)
+
+	report.phase(filesPhase)
+
+	err2 := deleteItems(ctx, files, deleteFn, report)
+
+	return joinErrors(err1, err2)
+}
+
+// deleteItems deletes the items in order, the items already deleted are SAME
+func deleteItems(ctx context.Context, items []Item, deleteFn func(item Item) error, report *Report) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	log.DbgLogger1.Printf("%s items to delete: %d", items[0].Kind.String(), len(items))
+	report.selected(items[0].Kind, items)
+
+	var errCount int
+
+	for i, item := range items {
+		if ctx.Err() != nil {
+			for _, item := range items[i:] {
+				report.add(item, StatusNotAttempted, nil, time.Now())
+			}
+
+			break
+		}
+
+		report.started(item)
+
+		start := time.Now()
+		err := deleteFn(item)
+		switch {
+		case err == nil:
+			report.add(item, StatusDeleted, nil, start)
+		case util.IsNotFound(err):
+			log.DbgLogger2.Println("item already deleted:", item.Name)
+			report.add(item, StatusSame, nil, start)
+		default:
+			errCount++
+			report.add(item, StatusError, err, start)
+		}
+	}
+
+	if errCount > 0 {
+		return fmt.Errorf("failed to delete %v items", errCount)
+	}
+
+	return nil
+}
+
+// splitQName returns the class and the name of an object qualified name
+func splitQName(qn string) (string, string) {
+	for i := 0; i < len(qn); i++ {
+		if qn[i] == '/' {
+			return qn[:i], qn[i+1:]
+		}
+	}
+
+	return qn, ""
+}
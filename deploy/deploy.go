@@ -0,0 +1,378 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deploy pushes, pulls and compares DataPower configuration projects,
+// it is the library behind the dpctl commands
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrInterrupted is returned when the context is cancelled before all items were processed
+var ErrInterrupted = errors.New("interrupted")
+
+// Kind is the kind of a processed item
+type Kind int
+
+const (
+	// KindFile is a file store file
+	KindFile Kind = iota
+	// KindObject is a configuration object
+	KindObject
+	// KindDomain is an application domain
+	KindDomain
+)
+
+func (k Kind) String() string {
+	names := [...]string{
+		"FILE",
+		"OBJECT",
+		"DOMAIN",
+	}
+
+	return names[k]
+}
+
+// Status is the outcome of a processed item
+type Status int
+
+const (
+	// StatusError means the item failed
+	StatusError Status = iota
+	// StatusOK means the item already existed and was updated
+	StatusOK
+	// StatusNew means the item was created
+	StatusNew
+	// StatusSuccess means the item was processed with an unknown outcome
+	StatusSuccess
+	// StatusDryRun means the item was not processed on purpose
+	StatusDryRun
+	// StatusDependencyFailed means a dependency of the object failed
+	StatusDependencyFailed
+	// StatusNotAttempted means the item was not processed because of an interruption
+	StatusNotAttempted
+	// StatusSame means the local and the remote items are identical
+	StatusSame
+	// StatusModified means the local and the remote items differ
+	StatusModified
+	// StatusLocalOnly means the item exists only in the project
+	StatusLocalOnly
+	// StatusRemoteOnly means the item exists only on DataPower
+	StatusRemoteOnly
+	// StatusUnrouted means the new item was not pulled as no package route matches it
+	StatusUnrouted
+	// StatusInventoried means the item was listed but its content cannot be pulled
+	StatusInventoried
+	// StatusDeleted means the item was deleted
+	StatusDeleted
+	// StatusConflict means the item changed both locally and remotely, or changed
+	// remotely while its local copy is patched or imported
+	StatusConflict
+	// StatusSkipped means the item was not pulled as its local copy cannot be updated
+	StatusSkipped
+)
+
+func (s Status) String() string {
+	names := [...]string{
+		"ERROR",
+		"OK",
+		"NEW",
+		"SUCCESS",
+		"DRYRUN",
+		"DEPENDENCY-FAILED",
+		"NOT-ATTEMPTED",
+		"SAME",
+		"MODIFIED",
+		"LOCAL-ONLY",
+		"REMOTE-ONLY",
+		"UNROUTED",
+		"INVENTORIED",
+		"DELETED",
+		"CONFLICT",
+		"SKIPPED",
+	}
+
+	return names[s]
+}
+
+// Completed reports whether the item was processed successfully
+func (s Status) Completed() bool {
+	switch s {
+	case StatusOK, StatusNew, StatusSuccess, StatusDryRun, StatusSame, StatusModified, StatusLocalOnly, StatusRemoteOnly, StatusInventoried, StatusDeleted:
+		return true
+	}
+
+	return false
+}
+
+// Failed reports whether the item failed
+func (s Status) Failed() bool {
+	return s == StatusError || s == StatusDependencyFailed || s == StatusConflict
+}
+
+// Item is a file or an object processed by an operation
+type Item struct {
+	Kind Kind
+	// Name is the file path, the object qualified name or the domain name
+	Name string
+	// Package is the name of the project package of the item
+	Package string
+}
+
+// Result is the outcome of a processed item
+type Result struct {
+	Item
+	Status  Status
+	Err     error
+	Elapsed time.Duration
+}
+
+// Phase is a step of an operation
+type Phase string
+
+const (
+	// PhaseValidateObjects validates the project objects against the DataPower schema
+	PhaseValidateObjects Phase = "VALIDATING OBJECTS"
+	// PhaseCreateDomain creates the application domain
+	PhaseCreateDomain Phase = "CREATING DOMAIN"
+	// PhaseListFiles lists the DataPower files
+	PhaseListFiles Phase = "LISTING FILES"
+	// PhaseListObjects lists the DataPower objects
+	PhaseListObjects Phase = "LISTING OBJECTS"
+	// PhaseListCrypto lists the DataPower certificate store files and certificates
+	PhaseListCrypto Phase = "LISTING CERTIFICATES"
+	// PhasePushFiles pushes the project files
+	PhasePushFiles Phase = "PUSHING FILES"
+	// PhasePushObjects pushes the project objects
+	PhasePushObjects Phase = "PUSHING OBJECTS"
+	// PhaseDeleteObjects deletes the DataPower objects removed from the project
+	PhaseDeleteObjects Phase = "DELETING OBJECTS"
+	// PhaseDeleteFiles deletes the DataPower files removed from the project
+	PhaseDeleteFiles Phase = "DELETING FILES"
+	// PhaseDeleteLocal deletes the project objects and files removed from DataPower
+	PhaseDeleteLocal Phase = "DELETING LOCAL ITEMS"
+	// PhasePullFiles pulls the DataPower files
+	PhasePullFiles Phase = "PULLING FILES"
+	// PhasePullObjects pulls the DataPower objects
+	PhasePullObjects Phase = "PULLING OBJECTS"
+	// PhasePullCrypto exports the DataPower certificates
+	PhasePullCrypto Phase = "EXPORTING CERTIFICATES"
+	// PhaseDiffFiles compares the project and the DataPower files
+	PhaseDiffFiles Phase = "COMPARING FILES"
+	// PhaseDiffObjects compares the project and the DataPower objects
+	PhaseDiffObjects Phase = "COMPARING OBJECTS"
+	// PhaseNormalizeObjects rewrites the project objects without the default properties
+	PhaseNormalizeObjects Phase = "NORMALIZING OBJECTS"
+	// PhaseFormatObjects rewrites the project object files in the canonical format
+	PhaseFormatObjects Phase = "FORMATTING OBJECTS"
+)
+
+// Hooks receive the progress of an operation, nil functions are ignored;
+// they may be called concurrently
+type Hooks struct {
+	// Phase is called when the operation starts a new phase
+	Phase func(phase Phase)
+	// Selected is called with the items of a kind selected for processing
+	Selected func(kind Kind, items []Item)
+	// Started is called when the processing of an item starts
+	Started func(item Item)
+	// Done is called when an item is processed, failed or skipped
+	Done func(result *Result)
+}
+
+// Report collects the results of an operation
+type Report struct {
+	// Results are the item results in completion order
+	Results []*Result
+	// Retries is the number of retried requests
+	Retries uint64
+	// Interrupted is set when the context was cancelled before all items were processed
+	Interrupted bool
+
+	mutex sync.Mutex
+	hooks *Hooks
+}
+
+func newReport(hooks *Hooks) *Report {
+	if hooks == nil {
+		hooks = &Hooks{}
+	}
+
+	return &Report{
+		hooks: hooks,
+	}
+}
+
+func (r *Report) phase(phase Phase) {
+	log.DbgLogger2.Println("phase:", phase)
+
+	if r.hooks.Phase != nil {
+		r.hooks.Phase(phase)
+	}
+}
+
+func (r *Report) started(item Item) {
+	if r.hooks.Started != nil {
+		r.hooks.Started(item)
+	}
+}
+
+func (r *Report) selected(kind Kind, items []Item) {
+	if r.hooks.Selected != nil {
+		r.hooks.Selected(kind, items)
+	}
+}
+
+func (r *Report) add(item Item, status Status, err error, start time.Time) *Result {
+	res := &Result{
+		Item:    item,
+		Status:  status,
+		Err:     err,
+		Elapsed: time.Since(start),
+	}
+
+	r.mutex.Lock()
+	r.Results = append(r.Results, res)
+	r.mutex.Unlock()
+
+	if r.hooks.Done != nil {
+		r.hooks.Done(res)
+	}
+
+	return res
+}
+
+// merge appends the results of a nested operation, its hooks already received them
+func (r *Report) merge(other *Report) {
+	other.mutex.Lock()
+	defer other.mutex.Unlock()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Results = append(r.Results, other.Results...)
+}
+
+// Count returns the number of results of a kind matching the filter
+func (r *Report) Count(kind Kind, filter func(Status) bool) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n := 0
+	for _, res := range r.Results {
+		if res.Kind == kind && filter(res.Status) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Summary returns the number of completed, failed and not attempted items
+func (r *Report) Summary() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var completed, failed, notAttempted int
+	for _, res := range r.Results {
+		switch {
+		case res.Status.Completed():
+			completed++
+		case res.Status.Failed():
+			failed++
+		case res.Status == StatusNotAttempted:
+			notAttempted++
+		}
+	}
+
+	return fmt.Sprintf("%d completed, %d failed, %d not attempted", completed, failed, notAttempted)
+}
+
+// Filter selects items by name, nil regular expressions match everything
+// for Include and nothing for Ignore
+type Filter struct {
+	Include *regexp.Regexp
+	Ignore  *regexp.Regexp
+}
+
+// Match reports whether the name is selected
+func (f Filter) Match(name string) bool {
+	if f.Include != nil && !f.Include.MatchString(name) {
+		return false
+	}
+
+	return f.Ignore == nil || !f.Ignore.MatchString(name)
+}
+
+// requestContext returns the context of the HTTP requests, it is cancelled
+// a grace period after ctx to let the requests in progress complete
+func requestContext(ctx context.Context, gracePeriod time.Duration) (context.Context, context.CancelFunc) {
+	rctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-rctx.Done():
+			return
+		}
+
+		log.DbgLogger1.Printf("waiting %v for the requests in progress", gracePeriod)
+
+		select {
+		case <-time.After(gracePeriod):
+			cancel()
+		case <-rctx.Done():
+		}
+	}()
+
+	return rctx, cancel
+}
+
+// acquireItem waits for a free slot to process an item, it fails once ctx is
+// cancelled even if a slot is available
+func acquireItem(ctx context.Context, sem *semaphore.Weighted) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return sem.Acquire(ctx, 1)
+}
+
+// waitItems waits for the items in progress, they are not interrupted
+// by the operation context but by the request context
+func waitItems(sem *semaphore.Weighted, n int64) {
+	if err := sem.Acquire(context.Background(), n); err != nil {
+		log.ErrLogger.Println("Error:", err.Error())
+		return
+	}
+
+	defer sem.Release(n)
+}
+
+func parallelism(parallel int) int64 {
+	if parallel < 1 {
+		return 1
+	}
+
+	return int64(parallel)
+}
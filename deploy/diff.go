@@ -0,0 +1,323 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"golang.org/x/sync/semaphore"
+)
+
+// DiffOptions are the options of Diff
+type DiffOptions struct {
+	// Packages are the project packages to compare
+	Packages util.PackageSlice
+	// Objects selects the objects by qualified name
+	Objects Filter
+	// Files selects the files by path
+	Files Filter
+	// Parallel is the maximum number of concurrent comparisons
+	Parallel int
+	// GracePeriod is the time given to the comparisons in progress when ctx is cancelled
+	GracePeriod time.Duration
+	// Normalizer normalizes the local and the remote objects before comparing them,
+	// nil to compare them as they are
+	Normalizer *util.Normalizer
+	// Hooks receive the progress of the comparison
+	Hooks *Hooks
+}
+
+// Diff compares the project files and objects with the DataPower ones, the
+// results are SAME, MODIFIED, LOCAL-ONLY or REMOTE-ONLY; nothing is changed
+func Diff(ctx context.Context, dp util.DataPower, opts *DiffOptions) (*Report, error) {
+	report := newReport(opts.Hooks)
+
+	rctx, cancel := requestContext(ctx, opts.GracePeriod)
+	defer cancel()
+
+	n := parallelism(opts.Parallel)
+	sem := semaphore.NewWeighted(n)
+
+	err1 := diffFiles(ctx, rctx, dp, opts.Files, opts.Packages, sem, n, report)
+
+	err2 := diffObjects(ctx, rctx, dp, opts.Objects, opts.Packages, opts.Normalizer, sem, n, report)
+
+	report.Retries = dp.Retries()
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		return report, ErrInterrupted
+	}
+
+	if err1 != nil && err2 != nil {
+		return report, fmt.Errorf("%s, %s", err1.Error(), err2.Error())
+	}
+
+	if err1 != nil {
+		return report, err1
+	}
+
+	return report, err2
+}
+
+// diffEntry pairs the local and the remote version of an item, either may be nil
+type diffEntry struct {
+	name   string
+	local  interface{}
+	remote interface{}
+}
+
+// diffEntries merges the local and the remote items by name, sorted by name
+func diffEntries(local, remote map[string]interface{}) []*diffEntry {
+	entries := make(map[string]*diffEntry)
+	for name, v := range local {
+		entries[name] = &diffEntry{name: name, local: v}
+	}
+
+	for name, v := range remote {
+		if e, ok := entries[name]; ok {
+			e.remote = v
+		} else {
+			entries[name] = &diffEntry{name: name, remote: v}
+		}
+	}
+
+	var res []*diffEntry
+	for _, e := range entries {
+		res = append(res, e)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].name < res[j].name
+	})
+
+	return res
+}
+
+// runDiff compares the entries concurrently, compareFn is called only for
+// the entries existing both locally and remotely
+func runDiff(ctx context.Context, kind Kind, entries []*diffEntry, itemFn func(e *diffEntry) Item, compareFn func(e *diffEntry) (Status, error), sem *semaphore.Weighted, n int64, report *Report) uint64 {
+	var items []Item
+	for _, e := range entries {
+		items = append(items, itemFn(e))
+	}
+
+	report.selected(kind, items)
+
+	var errCount uint64
+
+	for i, e := range entries {
+		switch {
+		case e.remote == nil:
+			report.add(itemFn(e), StatusLocalOnly, nil, time.Now())
+			continue
+		case e.local == nil:
+			report.add(itemFn(e), StatusRemoteOnly, nil, time.Now())
+			continue
+		}
+
+		if err := acquireItem(ctx, sem); err != nil {
+			for _, e := range entries[i:] {
+				report.add(itemFn(e), StatusNotAttempted, nil, time.Now())
+			}
+
+			break
+		}
+
+		go func(e *diffEntry) {
+			defer sem.Release(1)
+
+			report.started(itemFn(e))
+
+			start := time.Now()
+			status, err := compareFn(e)
+			if err != nil {
+				atomic.AddUint64(&errCount, 1)
+			}
+
+			report.add(itemFn(e), status, err, start)
+		}(e)
+	}
+
+	waitItems(sem, n)
+
+	return atomic.LoadUint64(&errCount)
+}
+
+func diffFiles(ctx, rctx context.Context, dp util.DataPower, filter Filter, pkgs util.PackageSlice, sem *semaphore.Weighted, n int64, report *Report) error {
+	files, err := util.GetProjectFiles(pkgs)
+	if err != nil {
+		return err
+	}
+
+	local := make(map[string]interface{})
+	for _, fileInfo := range files {
+		if !filter.Match(fileInfo.Path) {
+			log.DbgLogger2.Println("file ignored:", fileInfo.Path)
+			continue
+		}
+
+		local[fileInfo.Path] = fileInfo
+	}
+
+	report.phase(PhaseListFiles)
+
+	files, err = remoteFiles(ctx, dp, filter, pkgs)
+	if err != nil {
+		return err
+	}
+
+	report.phase(PhaseDiffFiles)
+
+	remote := make(map[string]interface{})
+	for _, fileInfo := range files {
+		remote[fileInfo.Path] = fileInfo
+	}
+
+	entries := diffEntries(local, remote)
+	log.DbgLogger1.Printf("files selected: %d", len(entries))
+
+	itemFn := func(e *diffEntry) Item {
+		if e.local != nil {
+			return fileItem(e.local.(*util.FileInfo))
+		}
+
+		return fileItem(e.remote.(*util.FileInfo))
+	}
+
+	compareFn := func(e *diffEntry) (Status, error) {
+		localData, err := e.local.(*util.FileInfo).Data()
+		if err != nil {
+			return StatusError, err
+		}
+
+		remoteData, err := dp.GetFile(rctx, e.name)
+		if err != nil {
+			return StatusError, err
+		}
+
+		if bytes.Equal(localData, remoteData) {
+			return StatusSame, nil
+		}
+
+		return StatusModified, nil
+	}
+
+	errCount := runDiff(ctx, KindFile, entries, itemFn, compareFn, sem, n, report)
+	if errCount > 0 {
+		return fmt.Errorf("failed to compare %v files", errCount)
+	}
+
+	return nil
+}
+
+func diffObjects(ctx, rctx context.Context, dp util.DataPower, filter Filter, pkgs util.PackageSlice, normalizer *util.Normalizer, sem *semaphore.Weighted, n int64, report *Report) error {
+	objects, err := util.GetProjectObjects(pkgs)
+	if err != nil {
+		return err
+	}
+
+	local := make(map[string]interface{})
+	for _, objInfo := range objects {
+		qn := objInfo.QName()
+
+		if !filter.Match(qn) {
+			log.DbgLogger2.Println("object ignored:", qn)
+			continue
+		}
+
+		local[qn] = objInfo
+	}
+
+	report.phase(PhaseListObjects)
+
+	objects, err = remoteObjects(ctx, dp, filter, pkgs)
+	if err != nil {
+		return err
+	}
+
+	report.phase(PhaseDiffObjects)
+
+	remote := make(map[string]interface{})
+	for _, objInfo := range objects {
+		remote[objInfo.QName()] = objInfo
+	}
+
+	entries := diffEntries(local, remote)
+	log.DbgLogger1.Printf("objects selected: %d", len(entries))
+
+	itemFn := func(e *diffEntry) Item {
+		if e.local != nil {
+			return objectItem(e.local.(*util.ObjectInfo))
+		}
+
+		return objectItem(e.remote.(*util.ObjectInfo))
+	}
+
+	compareFn := func(e *diffEntry) (Status, error) {
+		localInfo := e.local.(*util.ObjectInfo)
+		cls := localInfo.Class
+
+		// the object is read again as the links are removed before comparing
+		localObj, err := localInfo.ReadData()
+		if err != nil {
+			return StatusError, err
+		}
+
+		remoteObj, err := getRemoteObject(rctx, dp, e.remote.(*util.ObjectInfo))
+		if err != nil {
+			return StatusError, err
+		}
+
+		deleteLinks(localObj.(util.GenericMap))
+		deleteLinks(remoteObj.(util.GenericMap))
+
+		if normalizer != nil {
+			if err := normalizer.Normalize(cls, localObj.(util.GenericMap)); err != nil {
+				return StatusError, err
+			}
+
+			if err := normalizer.Normalize(cls, remoteObj.(util.GenericMap)); err != nil {
+				return StatusError, err
+			}
+		}
+
+		// the order-insensitive arrays are compared as sorted on pull
+		format := localInfo.Package.ObjectFormat()
+		format.SortArrays(cls, localObj)
+		format.SortArrays(cls, remoteObj)
+
+		if reflect.DeepEqual(localObj, remoteObj) {
+			return StatusSame, nil
+		}
+
+		return StatusModified, nil
+	}
+
+	errCount := runDiff(ctx, KindObject, entries, itemFn, compareFn, sem, n, report)
+	if errCount > 0 {
+		return fmt.Errorf("failed to compare %v objects", errCount)
+	}
+
+	return nil
+}
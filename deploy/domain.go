@@ -0,0 +1,135 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+)
+
+// DomainOptions are the options of CreateDomain
+type DomainOptions struct {
+	// Packages provide the domain settings
+	Packages util.PackageSlice
+	// Timeout is the maximum time to wait for the new domain to be up
+	Timeout time.Duration
+	// Hooks receive the result of the domain creation
+	Hooks *Hooks
+}
+
+// DomainPollInterval is the delay between two domain state checks
+var DomainPollInterval = 2 * time.Second
+
+// CreateDomain creates the client domain if it does not exist and waits for it to be up
+func CreateDomain(ctx context.Context, dp util.DataPower, opts *DomainOptions) (*Report, error) {
+	report := newReport(opts.Hooks)
+	report.phase(PhaseCreateDomain)
+
+	err := createDomain(ctx, dp, opts.Packages, opts.Timeout, report)
+
+	report.Retries = dp.Retries()
+
+	return report, err
+}
+
+func createDomain(ctx context.Context, dp util.DataPower, pkgs util.PackageSlice, timeout time.Duration, report *Report) error {
+	domain := dp.Domain()
+	if domain == "" {
+		return errors.New("domain not specified")
+	}
+
+	item := Item{
+		Kind: KindDomain,
+		Name: domain,
+	}
+
+	start := time.Now()
+
+	status, err := doCreateDomain(ctx, dp, pkgs, timeout)
+
+	report.add(item, status, err, start)
+
+	if err != nil {
+		return fmt.Errorf("failed to create domain %s", domain)
+	}
+
+	return nil
+}
+
+func doCreateDomain(ctx context.Context, dp util.DataPower, pkgs util.PackageSlice, timeout time.Duration) (Status, error) {
+	domain := dp.Domain()
+
+	ok, err := dp.InDomain("default").IsObject(ctx, "Domain", domain)
+	if err != nil {
+		return StatusError, err
+	}
+
+	if ok {
+		log.DbgLogger2.Println("domain already exists:", domain)
+		return StatusOK, nil
+	}
+
+	obj := util.DomainSettings(pkgs)
+	obj["name"] = domain
+	if _, ok := obj["mAdminState"]; !ok {
+		obj["mAdminState"] = "enabled"
+	}
+
+	log.DbgLogger4.Println("domain settings:", obj)
+
+	_, err = dp.InDomain("default").CreateOrUpdateObject(ctx, "Domain", obj)
+	if err != nil {
+		return StatusError, err
+	}
+
+	if err := waitDomain(ctx, dp, timeout); err != nil {
+		return StatusError, err
+	}
+
+	return StatusNew, nil
+}
+
+func waitDomain(ctx context.Context, dp util.DataPower, timeout time.Duration) error {
+	domain := dp.Domain()
+	deadline := time.Now().Add(timeout)
+
+	for {
+		opState, err := dp.InDomain("default").GetObjectOpState(ctx, "Domain", domain)
+		if err != nil {
+			return err
+		}
+
+		if opState == "up" {
+			return nil
+		}
+
+		log.DbgLogger2.Printf("domain %s is %s", domain, opState)
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("domain %s is not up after %v", domain, timeout)
+		}
+
+		select {
+		case <-time.After(DomainPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
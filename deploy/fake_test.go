@@ -0,0 +1,224 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lfeier/dpctl/util"
+)
+
+var errNotImplemented = errors.New("not implemented")
+
+// fakeDataPower is an in-memory DataPower used to test the operations
+type fakeDataPower struct {
+	domain string
+	// fail holds the errors returned for object qualified names or file paths
+	fail map[string]error
+
+	mutex   sync.Mutex
+	objects map[string]interface{}
+	files   map[string][]byte
+	// pushed are the object qualified names and file paths in push order
+	pushed []string
+}
+
+func newFakeDataPower(domain string) *fakeDataPower {
+	return &fakeDataPower{
+		domain:  domain,
+		fail:    make(map[string]error),
+		objects: make(map[string]interface{}),
+		files:   make(map[string][]byte),
+	}
+}
+
+func (f *fakeDataPower) Domain() string {
+	return f.domain
+}
+
+func (f *fakeDataPower) InDomain(domain string) util.DataPower {
+	return f
+}
+
+func (f *fakeDataPower) Retries() uint64 {
+	return 0
+}
+
+func (f *fakeDataPower) GetObjectClasses(ctx context.Context) ([]string, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeDataPower) GetObject(ctx context.Context, class, name string) (interface{}, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	obj, ok := f.objects[util.ObjectQName(class, name)]
+	if !ok {
+		return nil, &util.HTTPError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	}
+
+	return obj, nil
+}
+
+func (f *fakeDataPower) IsObject(ctx context.Context, class, name string) (bool, error) {
+	_, err := f.GetObject(ctx, class, name)
+	if util.IsNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (f *fakeDataPower) GetSingletonObject(ctx context.Context, class string) (interface{}, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeDataPower) GetObjects(ctx context.Context, class string) ([]interface{}, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeDataPower) CreateOrUpdateObject(ctx context.Context, cls string, obj interface{}) (interface{}, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	name := util.JSONValue(obj, "name").(string)
+	qn := util.ObjectQName(cls, name)
+
+	if err := f.fail[qn]; err != nil {
+		return nil, err
+	}
+
+	result := "Configuration was created."
+	if _, ok := f.objects[qn]; ok {
+		result = "Configuration was updated."
+	}
+
+	f.objects[qn] = obj
+	f.pushed = append(f.pushed, qn)
+
+	return util.GenericMap{name: result}, nil
+}
+
+func (f *fakeDataPower) GetFileStores(ctx context.Context) ([]string, error) {
+	return []string{"local"}, nil
+}
+
+func (f *fakeDataPower) GetFile(ctx context.Context, path string) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	data, ok := f.files[path]
+	if !ok {
+		return nil, &util.HTTPError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	}
+
+	return data, nil
+}
+
+func (f *fakeDataPower) IsDirectory(ctx context.Context, path string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeDataPower) CreateDirectories(ctx context.Context, path string) error {
+	return nil
+}
+
+func (f *fakeDataPower) CreateOrUpdateFile(ctx context.Context, path string, data []byte) (interface{}, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.fail[path]; err != nil {
+		return nil, err
+	}
+
+	result := "File was created."
+	if _, ok := f.files[path]; ok {
+		result = "File was updated."
+	}
+
+	f.files[path] = data
+	f.pushed = append(f.pushed, path)
+
+	return util.GenericMap{"result": result}, nil
+}
+
+func (f *fakeDataPower) DeleteObject(ctx context.Context, class, name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.objects, util.ObjectQName(class, name))
+
+	return nil
+}
+
+func (f *fakeDataPower) DeleteFile(ctx context.Context, path string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.files, path)
+
+	return nil
+}
+
+func (f *fakeDataPower) WalkFileStore(ctx context.Context, path string, walkDirFn util.WalkDirFunc, walkFileFn util.WalkFileFunc) error {
+	f.mutex.Lock()
+	var paths []string
+	for p := range f.files {
+		if strings.HasPrefix(p, path+"/") {
+			paths = append(paths, p)
+		}
+	}
+	f.mutex.Unlock()
+
+	for _, p := range paths {
+		if err := walkFileFn(p, "", uint(len(f.files[p]))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeDataPower) GetStatus(ctx context.Context, statusProvider string) (interface{}, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeDataPower) GetObjectOpState(ctx context.Context, class, name string) (string, error) {
+	return "up", nil
+}
+
+func (f *fakeDataPower) GetFirmwareVersion(ctx context.Context) (string, error) {
+	return "IDG.2018.4.1.0", nil
+}
+
+func (f *fakeDataPower) GetClassMetadata(ctx context.Context, class string) (interface{}, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeDataPower) GetTypeMetadata(ctx context.Context, href string) (interface{}, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeDataPower) ExecuteAction(ctx context.Context, name string, params interface{}) (interface{}, error) {
+	return nil, errNotImplemented
+}
+
+func (f *fakeDataPower) GetActionStatus(ctx context.Context, href string) (interface{}, error) {
+	return nil, errNotImplemented
+}
@@ -0,0 +1,169 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+)
+
+// FmtOptions are the options of Fmt
+type FmtOptions struct {
+	// Packages are the project packages to format, the imported packages are never formatted
+	Packages util.PackageSlice
+	// Objects selects the objects and the object patches by qualified name
+	Objects Filter
+	// Check reports the files not formatted without rewriting them
+	Check bool
+	// Hooks receive the progress of the formatting
+	Hooks *Hooks
+}
+
+// Fmt rewrites the object and the patch files of the project packages in the
+// canonical format declared by their package, the results are OK for the rewritten
+// files, SAME for the files already formatted and, in check mode, MODIFIED for
+// the files to format
+func Fmt(ctx context.Context, opts *FmtOptions) (*Report, error) {
+	report := newReport(opts.Hooks)
+
+	report.phase(PhaseFormatObjects)
+
+	var files []*util.ObjectFile
+	for _, pkg := range opts.Packages {
+		if pkg.External {
+			continue
+		}
+
+		pkgFiles, err := util.PackageObjectFiles(pkg)
+		if err != nil {
+			return report, err
+		}
+
+		for _, f := range pkgFiles {
+			if !opts.Objects.Match(f.QName()) {
+				log.DbgLogger2.Println("object ignored:", f.QName())
+				continue
+			}
+
+			files = append(files, f)
+		}
+	}
+
+	var items []Item
+	for _, f := range files {
+		items = append(items, objectFileItem(f))
+	}
+
+	log.DbgLogger1.Printf("object files selected: %d", len(files))
+	report.selected(KindObject, items)
+
+	var errCount, modifiedCount int
+
+	for i, f := range files {
+		if ctx.Err() != nil {
+			for _, f := range files[i:] {
+				report.add(objectFileItem(f), StatusNotAttempted, nil, time.Now())
+			}
+
+			break
+		}
+
+		report.started(objectFileItem(f))
+
+		start := time.Now()
+		status, err := fmtObjectFile(f, opts.Check)
+		switch {
+		case err != nil:
+			errCount++
+		case status == StatusModified:
+			modifiedCount++
+		}
+
+		report.add(objectFileItem(f), status, err, start)
+	}
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		return report, ErrInterrupted
+	}
+
+	if errCount > 0 {
+		return report, fmt.Errorf("failed to format %v object files", errCount)
+	}
+
+	if modifiedCount > 0 {
+		return report, fmt.Errorf("%v object files not formatted", modifiedCount)
+	}
+
+	return report, nil
+}
+
+// objectFileItem returns the item of an object file, the patch files are named after
+// their object with the patch suffix
+func objectFileItem(f *util.ObjectFile) Item {
+	name := f.QName()
+	if f.Patch {
+		name = fmt.Sprintf("%s (patch)", name)
+	}
+
+	return Item{
+		Kind:    KindObject,
+		Name:    name,
+		Package: f.Package.Name,
+	}
+}
+
+func fmtObjectFile(f *util.ObjectFile, check bool) (Status, error) {
+	data, err := ioutil.ReadFile(f.File)
+	if err != nil {
+		return StatusError, err
+	}
+
+	obj, err := util.ReadDataFromFile(f.File)
+	if err != nil {
+		return StatusError, err
+	}
+
+	format := f.Package.ObjectFormat()
+
+	var formatted []byte
+	if f.Patch {
+		formatted, err = format.FormatPatch(obj)
+	} else {
+		formatted, err = format.FormatObject(f.Class, obj)
+	}
+	if err != nil {
+		return StatusError, err
+	}
+
+	switch {
+	case bytes.Equal(data, formatted):
+		return StatusSame, nil
+	case check:
+		return StatusModified, nil
+	}
+
+	if err := ioutil.WriteFile(f.File, formatted, 0644); err != nil {
+		return StatusError, err
+	}
+
+	return StatusOK, nil
+}
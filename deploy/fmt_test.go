@@ -0,0 +1,88 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFmt(t *testing.T) {
+	dir, pkgs := testProject(t, map[string]string{
+		"pkg1/metadata.json":                       `{"priority": 1, "format": {"sort": {"HTTPUserAgent": ["Hosts"]}}}`,
+		"pkg1/objects/XMLManager/xm.json":          "{\n  \"name\": \"xm\"\n}\n",
+		"pkg1/objects/HTTPUserAgent/ua.json":       `{"name": "ua", "Hosts": ["b", "a"]}`,
+		"pkg1/objects/HTTPUserAgent/ua.patch.json": `[{"op": "add", "path": "/Hosts/-", "value": "c"}, {"op": "remove", "path": "/Hosts/0"}]`,
+		"pkg2/metadata.json":                       `{"priority": 2}`,
+		"pkg2/objects/XMLManager/xm.json":          `{"name": "xm", "CacheSize": 1}`,
+	})
+	defer os.RemoveAll(dir)
+
+	report, err := Fmt(context.Background(), &FmtOptions{Packages: pkgs, Check: true})
+	if err == nil || err.Error() != "3 object files not formatted" {
+		t.Errorf("Expected the check to fail, got '%v'", err)
+	}
+
+	expected := map[string]Status{
+		"HTTPUserAgent/ua [pkg1]":         StatusModified,
+		"HTTPUserAgent/ua (patch) [pkg1]": StatusModified,
+		"XMLManager/xm [pkg1]":            StatusSame,
+		"XMLManager/xm [pkg2]":            StatusModified,
+	}
+
+	checkResults := func() {
+		if len(report.Results) != len(expected) {
+			t.Errorf("Expected '%v' results, got '%v'", len(expected), len(report.Results))
+		}
+
+		for _, res := range report.Results {
+			name := res.Name + " [" + res.Package + "]"
+			if res.Status != expected[name] {
+				t.Errorf("%s: expected '%v', got '%v'", name, expected[name], res.Status)
+			}
+		}
+	}
+
+	checkResults()
+
+	if report, err = Fmt(context.Background(), &FmtOptions{Packages: pkgs}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, status := range expected {
+		if status == StatusModified {
+			expected[name] = StatusOK
+		}
+	}
+
+	checkResults()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "pkg1", "objects", "HTTPUserAgent", "ua.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ua := "{\n  \"Hosts\": [\n    \"a\",\n    \"b\"\n  ],\n  \"name\": \"ua\"\n}\n"
+	if string(data) != ua {
+		t.Errorf("Expected '%v', got '%s'", ua, data)
+	}
+
+	if _, err = Fmt(context.Background(), &FmtOptions{Packages: pkgs, Check: true}); err != nil {
+		t.Errorf("Expected formatted files, got '%v'", err)
+	}
+}
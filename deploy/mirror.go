@@ -0,0 +1,144 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+)
+
+// mirrorFiles deletes the DataPower files absent from the packages, only the stores
+// holding project files are walked and the shared and public certificate stores
+// are never touched
+func mirrorFiles(ctx, rctx context.Context, dp util.DataPower, opts *PushOptions, report *Report) error {
+	report.phase(PhaseListFiles)
+
+	files, err := util.GetProjectFiles(opts.Packages)
+	if err != nil {
+		return err
+	}
+
+	inProject := make(map[string]bool)
+	stores := make(map[string]bool)
+	for _, fileInfo := range files {
+		p := filepath.ToSlash(fileInfo.Path)
+		inProject[p] = true
+
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			inProject[dir] = true
+		}
+
+		stores[strings.SplitN(p, "/", 2)[0]] = true
+	}
+
+	// kept are the directories holding a file or a directory that is not deleted
+	kept := make(map[string]bool)
+	keep := func(p string) {
+		for dir := path.Dir(p); dir != "." && !kept[dir]; dir = path.Dir(dir) {
+			kept[dir] = true
+		}
+	}
+
+	var removedFiles []Item
+	var dirs []string
+
+	walkDir := func(p string) error {
+		if opts.Files.Ignore != nil && (opts.Files.Ignore.MatchString(p) || opts.Files.Ignore.MatchString(fmt.Sprintf("%s/", p))) {
+			log.DbgLogger2.Println("directory ignored:", p)
+			keep(p)
+			return util.ErrSkipDir
+		}
+
+		dirs = append(dirs, p)
+		return nil
+	}
+
+	walkFile := func(p string, modified string, size uint) error {
+		if inProject[p] || !opts.Files.Match(p) {
+			keep(p)
+			return nil
+		}
+
+		removedFiles = append(removedFiles, Item{Kind: KindFile, Name: p})
+		return nil
+	}
+
+	var storeNames []string
+	for store := range stores {
+		storeNames = append(storeNames, store)
+	}
+
+	sort.Strings(storeNames)
+
+	for _, store := range storeNames {
+		if store == "sharedcert" || store == "pubcert" || (store == certStore && !opts.Crypto) {
+			log.DbgLogger2.Println("store ignored:", store)
+			continue
+		}
+
+		if err := dp.WalkFileStore(ctx, store, walkDir, walkFile); err != nil {
+			return err
+		}
+	}
+
+	sortItems(removedFiles)
+
+	if opts.DeleteEmptyDirs {
+		// the subdirectories sort after their parent, reversed they are deleted first
+		sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+		for _, dir := range dirs {
+			if !kept[dir] && !inProject[dir] && !stores[dir] {
+				removedFiles = append(removedFiles, Item{Kind: KindFile, Name: dir + "/"})
+			}
+		}
+	}
+
+	if len(removedFiles) == 0 {
+		return nil
+	}
+
+	if opts.ConfirmDelete != nil {
+		var paths []string
+		for _, item := range removedFiles {
+			paths = append(paths, item.Name)
+		}
+
+		if !opts.ConfirmDelete(paths) {
+			log.DbgLogger1.Println("file deletion not confirmed")
+			report.selected(KindFile, removedFiles)
+
+			for _, item := range removedFiles {
+				report.add(item, StatusNotAttempted, nil, time.Now())
+			}
+
+			return nil
+		}
+	}
+
+	report.phase(PhaseDeleteFiles)
+
+	return deleteItems(ctx, removedFiles, func(item Item) error {
+		return dp.DeleteFile(rctx, strings.TrimSuffix(item.Name, "/"))
+	}, report)
+}
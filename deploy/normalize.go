@@ -0,0 +1,172 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+)
+
+// NormalizeOptions are the options of Normalize
+type NormalizeOptions struct {
+	// Packages are the project packages to rewrite, the imported packages are never rewritten
+	Packages util.PackageSlice
+	// Objects selects the objects by qualified name
+	Objects Filter
+	// Normalizer normalizes the objects
+	Normalizer *util.Normalizer
+	// Hooks receive the progress of the normalization
+	Hooks *Hooks
+}
+
+// Normalize rewrites the object files of the project packages without the properties
+// removed by the normalizer, the results are OK for the rewritten files and SAME for
+// the files already normalized; the patch files are not changed
+func Normalize(ctx context.Context, opts *NormalizeOptions) (*Report, error) {
+	report := newReport(opts.Hooks)
+
+	if opts.Normalizer == nil {
+		return report, errors.New("normalizer not specified")
+	}
+
+	report.phase(PhaseNormalizeObjects)
+
+	objects, err := packageObjects(opts.Packages, opts.Objects)
+	if err != nil {
+		return report, err
+	}
+
+	var items []Item
+	for _, objInfo := range objects {
+		items = append(items, objectItem(objInfo))
+	}
+
+	log.DbgLogger1.Printf("objects selected: %d", len(objects))
+	report.selected(KindObject, items)
+
+	var errCount int
+
+	for i, objInfo := range objects {
+		if ctx.Err() != nil {
+			for _, objInfo := range objects[i:] {
+				report.add(objectItem(objInfo), StatusNotAttempted, nil, time.Now())
+			}
+
+			break
+		}
+
+		report.started(objectItem(objInfo))
+
+		start := time.Now()
+		status, err := normalizeObject(opts.Normalizer, objInfo)
+		if err != nil {
+			errCount++
+		}
+
+		report.add(objectItem(objInfo), status, err, start)
+	}
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		return report, ErrInterrupted
+	}
+
+	if errCount > 0 {
+		return report, fmt.Errorf("failed to normalize %v objects", errCount)
+	}
+
+	return report, nil
+}
+
+// packageObjects returns the object files of the project packages matching the filter,
+// including the overridden objects; the imported packages are skipped
+func packageObjects(pkgs util.PackageSlice, filter Filter) (util.ObjectInfoSlice, error) {
+	var objects util.ObjectInfoSlice
+	for _, pkg := range pkgs {
+		if pkg.External {
+			continue
+		}
+
+		files, err := util.PackageObjectFiles(pkg)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if f.Patch {
+				continue
+			}
+
+			if !filter.Match(f.QName()) {
+				log.DbgLogger2.Println("object ignored:", f.QName())
+				continue
+			}
+
+			objects = append(objects, &util.ObjectInfo{
+				Name:    f.Name,
+				Class:   f.Class,
+				Package: f.Package,
+				File:    f.File,
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func normalizeObject(normalizer *util.Normalizer, objInfo *util.ObjectInfo) (Status, error) {
+	// the object file is read without the patches of the other packages
+	obj, err := util.ReadDataFromFile(objInfo.File)
+	if err != nil {
+		return StatusError, err
+	}
+
+	m, ok := obj.(util.GenericMap)
+	if !ok {
+		return StatusError, errors.New("object file must contain a JSON object")
+	}
+
+	// read again to keep the original object for the comparison
+	normalized, err := util.ReadDataFromFile(objInfo.File)
+	if err != nil {
+		return StatusError, err
+	}
+
+	if err := normalizer.Normalize(objInfo.Class, normalized.(util.GenericMap)); err != nil {
+		return StatusError, err
+	}
+
+	if reflect.DeepEqual(m, normalized) {
+		return StatusSame, nil
+	}
+
+	b, err := objInfo.Package.ObjectFormat().FormatObject(objInfo.Class, normalized)
+	if err != nil {
+		return StatusError, err
+	}
+
+	if err := ioutil.WriteFile(objInfo.File, b, 0644); err != nil {
+		return StatusError, err
+	}
+
+	return StatusOK, nil
+}
@@ -0,0 +1,492 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"golang.org/x/sync/semaphore"
+)
+
+// PullOptions are the options of Pull
+type PullOptions struct {
+	// Packages are the project packages receiving the pulled items, the new items
+	// are saved in the package with a matching route; when no package declares
+	// routes they are saved in the highest priority project package; the items
+	// of the imported packages and the objects with patches are skipped
+	Packages util.PackageSlice
+	// Objects selects the objects by qualified name
+	Objects Filter
+	// Files selects the files by path
+	Files Filter
+	// Parallel is the maximum number of concurrent pulls
+	Parallel int
+	// GracePeriod is the time given to the pulls in progress when ctx is cancelled
+	GracePeriod time.Duration
+	// Crypto exports the certificates of the CryptoCertificate objects to the
+	// cert: store files and inventories the other cert: store files
+	Crypto bool
+	// Normalizer normalizes the pulled objects, nil to save them as returned by DataPower
+	Normalizer *util.Normalizer
+	// Hooks receive the progress of the pull
+	Hooks *Hooks
+}
+
+// Pull saves the DataPower files and objects in the project packages,
+// once ctx is cancelled no new pull is started
+func Pull(ctx context.Context, dp util.DataPower, opts *PullOptions) (*Report, error) {
+	report := newReport(opts.Hooks)
+
+	rctx, cancel := requestContext(ctx, opts.GracePeriod)
+	defer cancel()
+
+	n := parallelism(opts.Parallel)
+	sem := semaphore.NewWeighted(n)
+
+	err1 := pullFiles(ctx, rctx, dp, opts.Files, opts.Packages, sem, n, report)
+
+	err2 := pullObjects(ctx, rctx, dp, opts.Objects, opts.Packages, opts.Normalizer, sem, n, report)
+
+	var err3 error
+	if opts.Crypto && ctx.Err() == nil {
+		err3 = pullCrypto(ctx, rctx, dp, opts.Objects, opts.Files, opts.Packages, sem, n, report)
+	}
+
+	report.Retries = dp.Retries()
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		return report, ErrInterrupted
+	}
+
+	return report, joinErrors(err1, err2, err3)
+}
+
+// joinErrors returns the non nil errors as a single error, nil if there are none
+func joinErrors(errs ...error) error {
+	var msgs []string
+	for _, err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+
+	switch len(msgs) {
+	case 0:
+		return nil
+	case 1:
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return errors.New(strings.Join(msgs, ", "))
+}
+
+// defaultPackage returns the highest priority project package, the pulled items are
+// never saved in the imported packages
+func defaultPackage(pkgs util.PackageSlice) (*util.Package, error) {
+	for _, pkg := range pkgs {
+		if !pkg.External {
+			return pkg, nil
+		}
+	}
+
+	return nil, errors.New("no project package to pull into, the packages are all imported")
+}
+
+// routeFile returns the package receiving a new file, nil if the packages
+// declare routes and none matches
+func routeFile(pkgs util.PackageSlice, path string) (*util.Package, error) {
+	if !util.HasRoutes(pkgs) {
+		return defaultPackage(pkgs)
+	}
+
+	return util.RouteFile(pkgs, path), nil
+}
+
+// routeObject returns the package receiving a new object, nil if the packages
+// declare routes and none matches
+func routeObject(pkgs util.PackageSlice, cls string, name string) (*util.Package, error) {
+	if !util.HasRoutes(pkgs) {
+		return defaultPackage(pkgs)
+	}
+
+	return util.RouteObject(pkgs, cls, name), nil
+}
+
+// remoteFiles lists the DataPower files matching the filter, the package
+// of the unrouted files is nil; the files of the imported packages keep their
+// package and are not pulled
+func remoteFiles(ctx context.Context, dp util.DataPower, filter Filter, pkgs util.PackageSlice) (util.FileInfoSlice, error) {
+	walkDir := func(path string) error {
+		if filter.Ignore != nil && (filter.Ignore.MatchString(path) || filter.Ignore.MatchString(fmt.Sprintf("%s/", path))) {
+			log.DbgLogger2.Println("directory ignored:", path)
+			return util.ErrSkipDir
+		}
+
+		return nil
+	}
+
+	var files util.FileInfoSlice
+	walkFile := func(path string, modified string, size uint) error {
+		if !filter.Match(path) {
+			log.DbgLogger2.Println("file ignored:", path)
+			return nil
+		}
+
+		pkg, err := util.GetFilePackage(pkgs, path)
+		if err != nil {
+			return err
+		}
+
+		if pkg == nil {
+			if pkg, err = routeFile(pkgs, path); err != nil {
+				return err
+			}
+		}
+
+		files = append(files, &util.FileInfo{
+			Path:    path,
+			Package: pkg,
+		})
+
+		return nil
+	}
+
+	stores, err := dp.GetFileStores(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, store := range stores {
+		if store == "cert" || store == "sharedcert" || store == "pubcert" {
+			log.DbgLogger2.Println("store ignored:", store)
+			continue
+		}
+
+		if err := dp.WalkFileStore(ctx, store, walkDir, walkFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// remoteObjects lists the DataPower objects matching the filter, the package
+// of the unrouted objects is nil; the objects of the imported packages keep
+// their package and are not pulled
+func remoteObjects(ctx context.Context, dp util.DataPower, filter Filter, pkgs util.PackageSlice) (util.ObjectInfoSlice, error) {
+	res, err := dp.GetStatus(ctx, "ObjectStatus")
+	if err != nil {
+		return nil, err
+	}
+
+	var objects util.ObjectInfoSlice
+	for _, objStatus := range util.JSONArray(util.JSONValue(res, "ObjectStatus")) {
+		name := util.JSONValue(objStatus, "Name").(string)
+		cls := util.JSONValue(objStatus, "Class").(string)
+		qn := util.ObjectQName(cls, name)
+
+		if !filter.Match(qn) {
+			log.DbgLogger2.Println("object ignored:", qn)
+			continue
+		}
+
+		pkg, err := util.GetObjectPackage(pkgs, qn)
+		if err != nil {
+			return nil, err
+		}
+
+		if pkg == nil {
+			if pkg, err = routeObject(pkgs, cls, name); err != nil {
+				return nil, err
+			}
+		}
+
+		objects = append(objects, &util.ObjectInfo{
+			Name:    name,
+			Class:   cls,
+			Package: pkg,
+		})
+	}
+
+	return objects, nil
+}
+
+func pullFiles(ctx, rctx context.Context, dp util.DataPower, filter Filter, pkgs util.PackageSlice, sem *semaphore.Weighted, n int64, report *Report) error {
+	report.phase(PhaseListFiles)
+
+	files, err := remoteFiles(ctx, dp, filter, pkgs)
+	if err != nil {
+		return err
+	}
+
+	report.phase(PhasePullFiles)
+
+	var items []Item
+	for _, fileInfo := range files {
+		items = append(items, fileItem(fileInfo))
+	}
+
+	log.DbgLogger1.Printf("files selected: %d", len(files))
+	report.selected(KindFile, items)
+
+	var errCount uint64
+
+	for i, fileInfo := range files {
+		if fileInfo.Package == nil {
+			log.DbgLogger1.Println("file not routed:", fileInfo.Path)
+			report.add(fileItem(fileInfo), StatusUnrouted, nil, time.Now())
+			continue
+		}
+
+		if fileInfo.Package.External {
+			log.DbgLogger1.Println("file imported:", fileInfo.Path)
+			report.add(fileItem(fileInfo), StatusSkipped, nil, time.Now())
+			continue
+		}
+
+		if err := acquireItem(ctx, sem); err != nil {
+			for _, fileInfo := range files[i:] {
+				report.add(fileItem(fileInfo), StatusNotAttempted, nil, time.Now())
+			}
+
+			break
+		}
+
+		go func(fileInfo *util.FileInfo) {
+			defer sem.Release(1)
+
+			report.started(fileItem(fileInfo))
+
+			start := time.Now()
+			status, err := pullFile(rctx, dp, fileInfo)
+			if err != nil {
+				atomic.AddUint64(&errCount, 1)
+			}
+
+			report.add(fileItem(fileInfo), status, err, start)
+		}(fileInfo)
+	}
+
+	waitItems(sem, n)
+
+	errCountFinal := atomic.LoadUint64(&errCount)
+	if errCountFinal > 0 {
+		return fmt.Errorf("failed to pull %v files", errCountFinal)
+	}
+
+	return nil
+}
+
+func pullFile(ctx context.Context, dp util.DataPower, fileInfo *util.FileInfo) (Status, error) {
+	data, err := dp.GetFile(ctx, fileInfo.Path)
+	if err != nil {
+		return StatusError, err
+	}
+
+	f, new, err := util.SaveFile(fileInfo.Package.Dir, fileInfo.Path, data)
+	if err != nil {
+		return StatusError, err
+	}
+
+	log.DbgLogger4.Println("file local path:", f)
+
+	if new {
+		return StatusNew, nil
+	}
+
+	return StatusOK, nil
+}
+
+func pullObjects(ctx, rctx context.Context, dp util.DataPower, filter Filter, pkgs util.PackageSlice, normalizer *util.Normalizer, sem *semaphore.Weighted, n int64, report *Report) error {
+	report.phase(PhaseListObjects)
+
+	objects, err := remoteObjects(ctx, dp, filter, pkgs)
+	if err != nil {
+		return err
+	}
+
+	patched, err := patchedObjects(pkgs)
+	if err != nil {
+		return err
+	}
+
+	report.phase(PhasePullObjects)
+
+	var items []Item
+	for _, objInfo := range objects {
+		items = append(items, objectItem(objInfo))
+	}
+
+	log.DbgLogger1.Printf("objects selected: %d", len(objects))
+	report.selected(KindObject, items)
+
+	var errCount uint64
+
+	for i, objInfo := range objects {
+		if objInfo.Package == nil {
+			log.DbgLogger1.Println("object not routed:", objInfo.QName())
+			report.add(objectItem(objInfo), StatusUnrouted, nil, time.Now())
+			continue
+		}
+
+		if objInfo.Package.External {
+			log.DbgLogger1.Println("object imported:", objInfo.QName())
+			report.add(objectItem(objInfo), StatusSkipped, nil, time.Now())
+			continue
+		}
+
+		// saving the patched values would overwrite the base object file
+		if patched[objInfo.QName()] {
+			log.DbgLogger1.Println("object patched:", objInfo.QName())
+			report.add(objectItem(objInfo), StatusSkipped, nil, time.Now())
+			continue
+		}
+
+		if err := acquireItem(ctx, sem); err != nil {
+			for _, objInfo := range objects[i:] {
+				report.add(objectItem(objInfo), StatusNotAttempted, nil, time.Now())
+			}
+
+			break
+		}
+
+		go func(objInfo *util.ObjectInfo) {
+			defer sem.Release(1)
+
+			report.started(objectItem(objInfo))
+
+			start := time.Now()
+			status, err := pullObject(rctx, dp, objInfo, normalizer)
+			if err != nil {
+				atomic.AddUint64(&errCount, 1)
+			}
+
+			report.add(objectItem(objInfo), status, err, start)
+		}(objInfo)
+	}
+
+	waitItems(sem, n)
+
+	errCountFinal := atomic.LoadUint64(&errCount)
+	if errCountFinal > 0 {
+		return fmt.Errorf("failed to pull %v objects", errCountFinal)
+	}
+
+	return nil
+}
+
+// patchedObjects returns the qualified names of the project objects with patches,
+// the layout problems of other objects are logged and do not stop the pull
+func patchedObjects(pkgs util.PackageSlice) (map[string]bool, error) {
+	objects, err := util.ScanProjectObjects(pkgs, func(path string, err error) error {
+		log.ErrLogger.Printf("Error: %s: %s", path, err.Error())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patched := make(map[string]bool)
+	for _, objInfo := range objects {
+		if len(objInfo.Patches) > 0 {
+			patched[objInfo.QName()] = true
+		}
+	}
+
+	return patched, nil
+}
+
+// getRemoteObject returns a DataPower object in the project format
+func getRemoteObject(ctx context.Context, dp util.DataPower, objInfo *util.ObjectInfo) (interface{}, error) {
+	obj, err := dp.GetObject(ctx, objInfo.Class, objInfo.Name)
+	if util.IsNotFound(err) {
+		obj, err = dp.GetSingletonObject(ctx, objInfo.Class)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := util.JSONValue(obj, "name").(string)
+	if objInfo.Name != name {
+		objInfo.Name = name
+	}
+
+	updateLinks(obj.(util.GenericMap), dp.Domain())
+
+	return obj, nil
+}
+
+func pullObject(ctx context.Context, dp util.DataPower, objInfo *util.ObjectInfo, normalizer *util.Normalizer) (Status, error) {
+	obj, err := getRemoteObject(ctx, dp, objInfo)
+	if err != nil {
+		return StatusError, err
+	}
+
+	if normalizer != nil {
+		if err := normalizer.Normalize(objInfo.Class, obj.(util.GenericMap)); err != nil {
+			return StatusError, err
+		}
+	}
+
+	f, new, err := util.SaveObject(objInfo.Package, objInfo.Class, objInfo.Name, obj)
+	if err != nil {
+		return StatusError, err
+	}
+
+	log.DbgLogger4.Println("object local path:", f)
+
+	if new {
+		return StatusNew, nil
+	}
+
+	return StatusOK, nil
+}
+
+func updateLinks(o util.GenericMap, domain string) {
+	for k, v := range o {
+		switch k {
+		case "_links":
+			delete(o, k)
+			continue
+		case "href":
+			o[k] = strings.Replace(v.(string), fmt.Sprintf("/mgmt/config/%s/", domain), "/mgmt/config/{domain}/", 1)
+			continue
+		}
+
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Map:
+			updateLinks(v.(util.GenericMap), domain)
+		case reflect.Slice:
+			for _, sv := range v.([]interface{}) {
+				if reflect.ValueOf(sv).Kind() == reflect.Map {
+					updateLinks(sv.(util.GenericMap), domain)
+				}
+			}
+		}
+	}
+}
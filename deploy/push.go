@@ -0,0 +1,507 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"golang.org/x/sync/semaphore"
+)
+
+// PushOptions are the options of Push
+type PushOptions struct {
+	// Packages are the project packages to push
+	Packages util.PackageSlice
+	// Objects selects the objects by qualified name
+	Objects Filter
+	// Files selects the files by path
+	Files Filter
+	// Parallel is the maximum number of concurrent pushes
+	Parallel int
+	// GracePeriod is the time given to the pushes in progress when ctx is cancelled
+	GracePeriod time.Duration
+	// CreateDomain creates the domain before pushing if it does not exist
+	CreateDomain bool
+	// DomainTimeout is the maximum time to wait for a new domain to be up
+	DomainTimeout time.Duration
+	// Schema validates the objects before pushing, only the changed ones when Changes
+	// is set, nil to skip the validation
+	Schema *util.SchemaRepository
+	// Crypto pushes the cert: store files, the certificates and the encrypted keys,
+	// the crypto objects are skipped when the file they reference failed
+	Crypto bool
+	// Changes restricts the push to the changed objects and files and to the objects
+	// referencing a changed object, nil to push the whole project
+	Changes *util.ProjectChanges
+	// DeleteRemoved deletes the DataPower objects and files removed from the project
+	// according to Changes, unless another package still provides them
+	DeleteRemoved bool
+	// DeleteFiles mirrors the file stores of the project files: the DataPower files
+	// matching Files and absent from the packages are deleted
+	DeleteFiles bool
+	// DeleteEmptyDirs also deletes the directories left without files by DeleteFiles
+	DeleteEmptyDirs bool
+	// ConfirmDelete is asked before DeleteFiles deletes the paths, they are not
+	// deleted unless it returns true; nil to delete without confirmation
+	ConfirmDelete func(paths []string) bool
+	// Hooks receive the progress of the push
+	Hooks *Hooks
+}
+
+// ValidationError is returned when objects fail the schema validation
+type ValidationError struct {
+	// Errors are the validation errors prefixed by the object qualified name
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("schema validation failed with %v errors", len(e.Errors))
+}
+
+// Push pushes the project files then the project objects in dependency order,
+// once ctx is cancelled no new push is started
+func Push(ctx context.Context, dp util.DataPower, opts *PushOptions) (*Report, error) {
+	report := newReport(opts.Hooks)
+
+	if opts.Schema != nil {
+		report.phase(PhaseValidateObjects)
+
+		if err := validateSchema(opts.Schema, opts.Objects, opts.Packages, opts.Changes); err != nil {
+			return report, err
+		}
+	}
+
+	if opts.CreateDomain {
+		report.phase(PhaseCreateDomain)
+
+		if err := createDomain(ctx, dp, opts.Packages, opts.DomainTimeout, report); err != nil {
+			return report, err
+		}
+	}
+
+	rctx, cancel := requestContext(ctx, opts.GracePeriod)
+	defer cancel()
+
+	n := parallelism(opts.Parallel)
+	sem := semaphore.NewWeighted(n)
+
+	failedFiles, err1 := pushFiles(ctx, rctx, dp, opts.Files, opts.Packages, opts.Crypto, opts.Changes, sem, n, report)
+
+	err2 := pushObjects(ctx, rctx, dp, opts.Objects, opts.Packages, opts.Changes, failedFiles, sem, n, report)
+
+	var err3 error
+	if opts.DeleteRemoved && opts.Changes != nil && ctx.Err() == nil {
+		err3 = deleteRemoved(ctx, rctx, dp, opts, report)
+	}
+
+	var err4 error
+	if opts.DeleteFiles && ctx.Err() == nil {
+		err4 = mirrorFiles(ctx, rctx, dp, opts, report)
+	}
+
+	report.Retries = dp.Retries()
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		return report, ErrInterrupted
+	}
+
+	return report, joinErrors(err1, err2, err3, err4)
+}
+
+// pushFiles pushes the project files and returns the paths of the files that failed
+func pushFiles(ctx, rctx context.Context, dp util.DataPower, filter Filter, pkgs util.PackageSlice, crypto bool, changes *util.ProjectChanges, sem *semaphore.Weighted, n int64, report *Report) (map[string]bool, error) {
+	report.phase(PhasePushFiles)
+
+	files, err := util.GetProjectFiles(pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	matchingFiles := files[:0]
+	var items []Item
+	for _, fileInfo := range files {
+		if !filter.Match(fileInfo.Path) {
+			log.DbgLogger2.Println("file ignored:", fileInfo.Path)
+			continue
+		}
+
+		if !crypto && isCertFile(fileInfo.Path) {
+			log.DbgLogger2.Println("certificate store file ignored:", fileInfo.Path)
+			continue
+		}
+
+		if changes != nil && !changes.Files[fileInfo.Path] {
+			log.DbgLogger2.Println("file unchanged:", fileInfo.Path)
+			continue
+		}
+
+		matchingFiles = append(matchingFiles, fileInfo)
+		items = append(items, fileItem(fileInfo))
+	}
+
+	log.DbgLogger1.Printf("files selected: %d", len(matchingFiles))
+	report.selected(KindFile, items)
+
+	var errCount uint64
+
+	var mutex sync.Mutex
+	failed := make(map[string]bool)
+
+	for i, fileInfo := range matchingFiles {
+		if err := acquireItem(ctx, sem); err != nil {
+			for _, fileInfo := range matchingFiles[i:] {
+				report.add(fileItem(fileInfo), StatusNotAttempted, nil, time.Now())
+			}
+
+			break
+		}
+
+		go func(fileInfo *util.FileInfo) {
+			defer sem.Release(1)
+
+			report.started(fileItem(fileInfo))
+
+			start := time.Now()
+			status, err := pushFile(rctx, dp, fileInfo)
+			if err != nil {
+				atomic.AddUint64(&errCount, 1)
+
+				mutex.Lock()
+				failed[fileInfo.Path] = true
+				mutex.Unlock()
+			}
+
+			report.add(fileItem(fileInfo), status, err, start)
+		}(fileInfo)
+	}
+
+	waitItems(sem, n)
+
+	errCountFinal := atomic.LoadUint64(&errCount)
+	if errCountFinal > 0 {
+		return failed, fmt.Errorf("failed to push %v files", errCountFinal)
+	}
+
+	return failed, nil
+}
+
+func pushFile(ctx context.Context, dp util.DataPower, fileInfo *util.FileInfo) (Status, error) {
+	data, err := fileInfo.Data()
+	if err != nil {
+		return StatusError, err
+	}
+
+	res, err := dp.CreateOrUpdateFile(ctx, fileInfo.Path, data)
+	if err != nil {
+		return StatusError, err
+	}
+
+	resStr, _ := util.JSONValue(res, "result").(string)
+	switch {
+	case strings.Contains(resStr, "File was updated"):
+		return StatusOK, nil
+	case strings.Contains(resStr, "File was created"):
+		return StatusNew, nil
+	default:
+		return StatusSuccess, nil
+	}
+}
+
+func pushObjects(ctx, rctx context.Context, dp util.DataPower, filter Filter, pkgs util.PackageSlice, changes *util.ProjectChanges, failedFiles map[string]bool, sem *semaphore.Weighted, n int64, report *Report) error {
+	report.phase(PhasePushObjects)
+
+	objects, err := util.GetProjectObjects(pkgs)
+	if err != nil {
+		return err
+	}
+
+	if changes != nil {
+		objects, err = changedObjects(objects, changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	matchingObjects := objects[:0]
+	var items []Item
+	for _, objInfo := range objects {
+		qn := objInfo.QName()
+
+		if !filter.Match(qn) {
+			log.DbgLogger2.Println("object ignored:", qn)
+			continue
+		}
+
+		matchingObjects = append(matchingObjects, objInfo)
+		items = append(items, objectItem(objInfo))
+	}
+
+	log.DbgLogger1.Printf("objects selected: %d", len(matchingObjects))
+	report.selected(KindObject, items)
+
+	g := util.NewObjectGraph(matchingObjects)
+
+	levels, err := g.Levels()
+	if err != nil {
+		return err
+	}
+
+	var errCount uint64
+
+	var mutex sync.Mutex
+	failed := make(map[string]bool)
+
+	for i, level := range levels {
+		log.DbgLogger2.Printf("dependency level %d: %d objects", i, len(level))
+
+		for _, objInfo := range level {
+			if ctx.Err() != nil {
+				report.add(objectItem(objInfo), StatusNotAttempted, nil, time.Now())
+				continue
+			}
+
+			d := failedDependency(g, objInfo, failed, &mutex)
+			if d == "" {
+				d = failedCryptoFile(objInfo, failedFiles)
+			}
+
+			if d != "" {
+				log.DbgLogger1.Printf("object skipped: %s, dependency failed: %s", objInfo.QName(), d)
+
+				mutex.Lock()
+				failed[objInfo.QName()] = true
+				mutex.Unlock()
+
+				atomic.AddUint64(&errCount, 1)
+				report.add(objectItem(objInfo), StatusDependencyFailed, nil, time.Now())
+				continue
+			}
+
+			if err := acquireItem(ctx, sem); err != nil {
+				report.add(objectItem(objInfo), StatusNotAttempted, nil, time.Now())
+				continue
+			}
+
+			go func(objInfo *util.ObjectInfo) {
+				defer sem.Release(1)
+
+				report.started(objectItem(objInfo))
+
+				start := time.Now()
+				status, err := pushObject(rctx, dp, objInfo)
+				if err != nil {
+					atomic.AddUint64(&errCount, 1)
+
+					mutex.Lock()
+					failed[objInfo.QName()] = true
+					mutex.Unlock()
+				}
+
+				report.add(objectItem(objInfo), status, err, start)
+			}(objInfo)
+		}
+
+		// the next level starts only after all dependencies were pushed
+		waitItems(sem, n)
+	}
+
+	errCountFinal := atomic.LoadUint64(&errCount)
+	if errCountFinal > 0 {
+		return fmt.Errorf("failed to push %v objects", errCountFinal)
+	}
+
+	return nil
+}
+
+// changedObjects returns the changed objects and the objects referencing a changed object
+func changedObjects(objects util.ObjectInfoSlice, changes *util.ProjectChanges) (util.ObjectInfoSlice, error) {
+	var res util.ObjectInfoSlice
+
+	for _, objInfo := range objects {
+		qn := objInfo.QName()
+
+		if changes.Objects[qn] {
+			res = append(res, objInfo)
+			continue
+		}
+
+		depend, err := objInfo.Depend()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range depend {
+			if changes.Objects[d] {
+				log.DbgLogger2.Printf("object selected: %s, dependency changed: %s", qn, d)
+				res = append(res, objInfo)
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// failedDependency returns the first dependency of the object that failed to push
+func failedDependency(g *util.ObjectGraph, objInfo *util.ObjectInfo, failed map[string]bool, mutex *sync.Mutex) string {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, d := range g.Edges[objInfo.QName()] {
+		if failed[d] {
+			return d
+		}
+	}
+
+	return ""
+}
+
+func pushObject(ctx context.Context, dp util.DataPower, objInfo *util.ObjectInfo) (Status, error) {
+	obj, err := objInfo.Data()
+	if err != nil {
+		return StatusError, err
+	}
+
+	deleteLinks(obj.(util.GenericMap))
+
+	err = util.ValidateObjectName(objInfo.Name, obj)
+	if err != nil {
+		return StatusError, err
+	}
+
+	res, err := dp.CreateOrUpdateObject(ctx, objInfo.Class, obj)
+	if err != nil {
+		return StatusError, err
+	}
+
+	resVal := util.JSONValue(res, objInfo.Name)
+	if resVal == nil {
+		resVal = util.JSONValue(res, strings.Replace(objInfo.Name, " ", "_", -1))
+	}
+
+	if resVal == nil {
+		return StatusError, fmt.Errorf("unknown push result")
+	}
+
+	switch {
+	case strings.Contains(resVal.(string), "Configuration was updated"):
+		return StatusOK, nil
+	case strings.Contains(resVal.(string), "Configuration was created"):
+		return StatusNew, nil
+	default:
+		return StatusSuccess, nil
+	}
+}
+
+// validateSchema validates the objects selected by filter, only the changed ones
+// when changes is not nil
+func validateSchema(schemaRepo *util.SchemaRepository, filter Filter, pkgs util.PackageSlice, changes *util.ProjectChanges) error {
+	objects, err := util.GetProjectObjects(pkgs)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].QName() < objects[j].QName()
+	})
+
+	var errs []error
+	for _, objInfo := range objects {
+		qn := objInfo.QName()
+
+		if !filter.Match(qn) || (changes != nil && !changes.Objects[qn]) {
+			continue
+		}
+
+		obj, err := objInfo.Data()
+		if err != nil {
+			return err
+		}
+
+		objErrs, err := schemaRepo.ValidateObject(objInfo.Class, obj)
+		if err != nil {
+			return err
+		}
+
+		for _, err := range objErrs {
+			errs = append(errs, fmt.Errorf("%s: %s", qn, err.Error()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+func deleteLinks(o util.GenericMap) {
+	for k, v := range o {
+		switch k {
+		case "_links":
+			delete(o, k)
+			continue
+		case "href":
+			delete(o, k)
+			continue
+		}
+
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Map:
+			deleteLinks(v.(util.GenericMap))
+		case reflect.Slice:
+			for _, sv := range v.([]interface{}) {
+				if reflect.ValueOf(sv).Kind() == reflect.Map {
+					deleteLinks(sv.(util.GenericMap))
+				}
+			}
+		}
+	}
+}
+
+func fileItem(fileInfo *util.FileInfo) Item {
+	return Item{
+		Kind:    KindFile,
+		Name:    fileInfo.Path,
+		Package: packageName(fileInfo.Package),
+	}
+}
+
+func objectItem(objInfo *util.ObjectInfo) Item {
+	return Item{
+		Kind:    KindObject,
+		Name:    objInfo.QName(),
+		Package: packageName(objInfo.Package),
+	}
+}
+
+// packageName returns the package name, empty for the unrouted items
+func packageName(pkg *util.Package) string {
+	if pkg == nil {
+		return ""
+	}
+
+	return pkg.Name
+}
@@ -0,0 +1,132 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestPushInterrupted(t *testing.T) {
+	dir, pkgs := testProject(t, map[string]string{
+		"pkg1/metadata.json":               `{"priority": 1}`,
+		"pkg1/objects/XMLManager/xm1.json": `{"name": "xm1"}`,
+		"pkg1/objects/XMLManager/xm2.json": `{"name": "xm2"}`,
+		"pkg1/files/local/a.xsl":           `<xsl:stylesheet/>`,
+	})
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dp := newFakeDataPower("d")
+
+	report, err := Push(ctx, dp, &PushOptions{Packages: pkgs, Parallel: 1})
+	if err != ErrInterrupted {
+		t.Fatalf("Expected '%v', got '%v'", ErrInterrupted, err)
+	}
+
+	expected := "0 completed, 0 failed, 3 not attempted"
+	if report.Summary() != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, report.Summary())
+	}
+
+	if !report.Interrupted {
+		t.Errorf("Expected the report to be interrupted")
+	}
+
+	if len(dp.pushed) != 0 {
+		t.Errorf("Expected no push, got '%v'", dp.pushed)
+	}
+}
+
+func TestPushObjects(t *testing.T) {
+	dir, pkgs := testProject(t, map[string]string{
+		"pkg1/metadata.json":                        `{"priority": 1}`,
+		"pkg1/objects/MultiProtocolGateway/gw.json": `{"name": "gw", "StylePolicy": {"value": "sp", "href": "/mgmt/config/{domain}/MPGWStylePolicy/sp"}}`,
+		"pkg1/objects/MPGWStylePolicy/sp.json":      `{"name": "sp", "XMLManager": {"value": "xm", "href": "/mgmt/config/{domain}/XMLManager/xm"}}`,
+		"pkg1/objects/XMLManager/xm.json":           `{"name": "xm"}`,
+		"pkg1/objects/XMLManager/xm2.json":          `{"name": "xm2"}`,
+		"pkg1/objects/HTTPUserAgent/ua.json":        `{"name": "ua", "XMLManager": {"value": "xm2", "href": "/mgmt/config/{domain}/XMLManager/xm2"}}`,
+	})
+	defer os.RemoveAll(dir)
+
+	dp := newFakeDataPower("d")
+	dp.fail["XMLManager/xm2"] = errors.New("xm2 rejected")
+
+	var selected []Item
+	statuses := make(map[string]Status)
+	hooks := &Hooks{
+		Selected: func(kind Kind, items []Item) {
+			if kind == KindObject {
+				selected = items
+			}
+		},
+		Done: func(res *Result) {
+			statuses[res.Name] = res.Status
+		},
+	}
+
+	report, err := Push(context.Background(), dp, &PushOptions{Packages: pkgs, Parallel: 1, Hooks: hooks})
+	if err == nil {
+		t.Fatal("Expected push to fail")
+	}
+
+	expected := []string{"XMLManager/xm", "MPGWStylePolicy/sp", "MultiProtocolGateway/gw"}
+	if !reflect.DeepEqual(dp.pushed, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, dp.pushed)
+	}
+
+	expectedSummary := "3 completed, 2 failed, 0 not attempted"
+	if report.Summary() != expectedSummary {
+		t.Errorf("Expected '%v', got '%v'", expectedSummary, report.Summary())
+	}
+
+	if len(selected) != 5 {
+		t.Errorf("Expected '%v' selected objects, got '%v'", 5, len(selected))
+	}
+
+	if statuses["HTTPUserAgent/ua"] != StatusDependencyFailed {
+		t.Errorf("Expected '%v', got '%v'", StatusDependencyFailed, statuses["HTTPUserAgent/ua"])
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	f := Filter{}
+	if !f.Match("XMLManager/xm") {
+		t.Errorf("Expected an empty filter to match")
+	}
+
+	f = Filter{
+		Include: regexp.MustCompile("^XMLManager/"),
+		Ignore:  regexp.MustCompile("xm2$"),
+	}
+
+	tests := map[string]bool{
+		"XMLManager/xm":    true,
+		"XMLManager/xm2":   false,
+		"HTTPUserAgent/ua": false,
+	}
+
+	for name, expected := range tests {
+		if f.Match(name) != expected {
+			t.Errorf("Expected '%v' for '%v', got '%v'", expected, name, !expected)
+		}
+	}
+}
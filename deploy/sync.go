@@ -0,0 +1,810 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+	"golang.org/x/sync/semaphore"
+)
+
+// SyncOptions are the options of Sync
+type SyncOptions struct {
+	// Packages are the project packages to synchronize
+	Packages util.PackageSlice
+	// Objects selects the objects by qualified name
+	Objects Filter
+	// Files selects the files by path, the cert: store files are never synchronized
+	Files Filter
+	// Parallel is the maximum number of concurrent requests
+	Parallel int
+	// GracePeriod is the time given to the requests in progress when ctx is cancelled
+	GracePeriod time.Duration
+	// Normalizer normalizes the objects before hashing them and the pulled objects,
+	// nil to use them as they are
+	Normalizer *util.Normalizer
+	// StateFile records the hashes of the items at the last sync, it is created
+	// by the first sync
+	StateFile string
+	// ConflictsDir receives the remote version of the conflicting items in the
+	// package layout, empty to not write them
+	ConflictsDir string
+	// Hooks receive the progress of the sync
+	Hooks *Hooks
+}
+
+// syncState is the content of the sync state file
+type syncState struct {
+	Objects map[string]*syncHashes `json:"objects"`
+	Files   map[string]*syncHashes `json:"files"`
+}
+
+// syncHashes are the hashes of the local and the remote version of an item at the
+// last sync, they differ when DataPower completes a pushed object
+type syncHashes struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// syncAction is what the sync does with an item
+type syncAction int
+
+const (
+	// syncNone leaves an item unchanged since the last sync
+	syncNone syncAction = iota
+	// syncSame records an item identical on both sides
+	syncSame
+	syncPush
+	syncPull
+	syncDeleteRemote
+	syncDeleteLocal
+	syncConflict
+)
+
+// syncEntry pairs the local and the remote version of an item with their hashes,
+// the hash of a missing version is empty
+type syncEntry struct {
+	*diffEntry
+	kind       Kind
+	localHash  string
+	remoteHash string
+	failed     bool
+	action     syncAction
+	// copies are the files of the local item in every package, with the patches
+	copies []string
+	// imported reports whether a copy is in an imported package
+	imported bool
+}
+
+// locked reports whether the local item cannot follow a remote change, the pulled
+// values would overwrite the base of its patches or an imported package
+func (e *syncEntry) locked() bool {
+	if objInfo, ok := e.local.(*util.ObjectInfo); ok && len(objInfo.Patches) > 0 {
+		return true
+	}
+
+	return e.imported
+}
+
+func (e *syncEntry) item() Item {
+	info := e.local
+	if info == nil {
+		info = e.remote
+	}
+
+	if e.kind == KindFile {
+		return fileItem(info.(*util.FileInfo))
+	}
+
+	return objectItem(info.(*util.ObjectInfo))
+}
+
+// Sync pushes the items changed only in the project and pulls the items changed
+// only on DataPower since the last sync, the items changed on both sides are
+// reported as CONFLICT and left unchanged; the state file records the items
+// synchronized successfully
+func Sync(ctx context.Context, dp util.DataPower, opts *SyncOptions) (*Report, error) {
+	report := newReport(opts.Hooks)
+
+	state, err := readSyncState(opts.StateFile)
+	if err != nil {
+		return report, err
+	}
+
+	rctx, cancel := requestContext(ctx, opts.GracePeriod)
+	defer cancel()
+
+	n := parallelism(opts.Parallel)
+	sem := semaphore.NewWeighted(n)
+
+	files, err1 := syncFileEntries(ctx, rctx, dp, opts, sem, n, report)
+
+	objects, err2 := syncObjectEntries(ctx, rctx, dp, opts, sem, n, report)
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		return report, ErrInterrupted
+	}
+
+	// the items are listed before being hashed, without entries the listing failed
+	if (err1 != nil && files == nil) || (err2 != nil && objects == nil) {
+		return report, joinErrors(err1, err2)
+	}
+
+	for _, e := range files {
+		e.action = syncActionOf(e, state.Files[e.name])
+	}
+
+	for _, e := range objects {
+		e.action = syncActionOf(e, state.Objects[e.name])
+	}
+
+	err3 := applySync(ctx, rctx, dp, opts, files, objects, report)
+
+	results := make(map[Item]Status)
+	for _, res := range report.Results {
+		results[Item{Kind: res.Kind, Name: res.Name}] = res.Status
+	}
+
+	updateSyncState(rctx, dp, opts, files, results, state.Files)
+	updateSyncState(rctx, dp, opts, objects, results, state.Objects)
+
+	err4 := writeSyncState(opts.StateFile, state)
+
+	report.Retries = dp.Retries()
+
+	if ctx.Err() != nil {
+		report.Interrupted = true
+		return report, ErrInterrupted
+	}
+
+	return report, joinErrors(err1, err2, err3, err4)
+}
+
+// syncActionOf classifies an entry against its hashes at the last sync
+func syncActionOf(e *syncEntry, last *syncHashes) syncAction {
+	switch {
+	case e.failed:
+		return syncNone
+	case e.localHash == e.remoteHash:
+		return syncSame
+	case last == nil && e.remote == nil:
+		return syncPush
+	case last == nil && e.local == nil:
+		return syncPull
+	case last == nil:
+		return syncConflict
+	}
+
+	localChanged := e.localHash != last.Local
+	remoteChanged := e.remoteHash != last.Remote
+
+	switch {
+	case localChanged && remoteChanged:
+		return syncConflict
+	case remoteChanged && e.local != nil && e.locked():
+		return syncConflict
+	case localChanged && e.local == nil:
+		return syncDeleteRemote
+	case localChanged:
+		return syncPush
+	case remoteChanged && e.remote == nil:
+		return syncDeleteLocal
+	case remoteChanged:
+		return syncPull
+	}
+
+	return syncNone
+}
+
+// applySync pulls, pushes and deletes the entries then reports the conflicts
+func applySync(ctx, rctx context.Context, dp util.DataPower, opts *SyncOptions, files, objects []*syncEntry, report *Report) error {
+	names := func(entries []*syncEntry, action syncAction) []string {
+		var res []string
+		for _, e := range entries {
+			if e.action == action {
+				res = append(res, e.name)
+			}
+		}
+
+		return res
+	}
+
+	var errs []error
+
+	pullFiles, pullObjects := names(files, syncPull), names(objects, syncPull)
+	if len(pullFiles) > 0 || len(pullObjects) > 0 {
+		sub, err := Pull(ctx, dp, &PullOptions{
+			Packages:    opts.Packages,
+			Objects:     exactFilter(pullObjects, opts.Objects),
+			Files:       exactFilter(pullFiles, opts.Files),
+			Parallel:    opts.Parallel,
+			GracePeriod: opts.GracePeriod,
+			Normalizer:  opts.Normalizer,
+			Hooks:       opts.Hooks,
+		})
+
+		report.merge(sub)
+		errs = append(errs, err)
+	}
+
+	pushFiles, pushObjects := names(files, syncPush), names(objects, syncPush)
+	if ctx.Err() == nil && (len(pushFiles) > 0 || len(pushObjects) > 0) {
+		sub, err := Push(ctx, dp, &PushOptions{
+			Packages:    opts.Packages,
+			Objects:     exactFilter(pushObjects, opts.Objects),
+			Files:       exactFilter(pushFiles, opts.Files),
+			Parallel:    opts.Parallel,
+			GracePeriod: opts.GracePeriod,
+			Hooks:       opts.Hooks,
+		})
+
+		report.merge(sub)
+		errs = append(errs, err)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	var deleteObjects util.ObjectInfoSlice
+	for _, e := range objects {
+		if e.action != syncDeleteRemote {
+			continue
+		}
+
+		// the remote references order the deletion
+		objInfo := e.remote.(*util.ObjectInfo)
+		obj, err := getRemoteObject(rctx, dp, &util.ObjectInfo{Class: objInfo.Class, Name: objInfo.Name})
+		if err != nil {
+			log.DbgLogger2.Printf("object references not read: %s, %v", e.name, err)
+		}
+
+		deleteObjects = append(deleteObjects, util.NewObjectInfo(objInfo.Class, objInfo.Name, obj))
+	}
+
+	errs = append(errs, deleteRemote(ctx, rctx, dp, deleteObjects, syncItems(files, syncDeleteRemote), report))
+
+	copies := make(map[string][]string)
+	for _, entries := range [][]*syncEntry{files, objects} {
+		for _, e := range entries {
+			if e.action == syncDeleteLocal {
+				copies[e.name] = e.copies
+			}
+		}
+	}
+
+	errs = append(errs, deleteAll(ctx, PhaseDeleteLocal, syncItems(objects, syncDeleteLocal), PhaseDeleteLocal, syncItems(files, syncDeleteLocal), func(item Item) error {
+		// a copy left in another package would be pushed back by the next sync
+		for _, f := range copies[item.Name] {
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, report))
+
+	var conflicts int
+	for _, entries := range [][]*syncEntry{files, objects} {
+		for _, e := range entries {
+			if e.action != syncConflict {
+				continue
+			}
+
+			conflicts++
+
+			var err error
+			if opts.ConflictsDir != "" && e.remote != nil {
+				err = writeConflict(rctx, dp, opts, e)
+			}
+
+			report.add(e.item(), StatusConflict, err, time.Now())
+		}
+	}
+
+	if conflicts > 0 {
+		msg := fmt.Sprintf("%d items in conflict", conflicts)
+		if opts.ConflictsDir != "" {
+			msg += ", the remote versions are in " + opts.ConflictsDir
+		}
+
+		errs = append(errs, fmt.Errorf("%s", msg))
+	}
+
+	return joinErrors(errs...)
+}
+
+// syncItems returns the items of the entries with the action, in entry order
+func syncItems(entries []*syncEntry, action syncAction) []Item {
+	var items []Item
+	for _, e := range entries {
+		if e.action == action {
+			items = append(items, e.item())
+		}
+	}
+
+	return items
+}
+
+// exactFilter selects the named items only, none when names is empty; the
+// ignored items of filter stay ignored, e.g. to skip their directories
+func exactFilter(names []string, filter Filter) Filter {
+	var quoted []string
+	for _, name := range names {
+		quoted = append(quoted, regexp.QuoteMeta(name))
+	}
+
+	return Filter{
+		Include: regexp.MustCompile(fmt.Sprintf("^(%s)$", strings.Join(quoted, "|"))),
+		Ignore:  filter.Ignore,
+	}
+}
+
+// syncFileEntries lists and hashes the local and the remote files
+func syncFileEntries(ctx, rctx context.Context, dp util.DataPower, opts *SyncOptions, sem *semaphore.Weighted, n int64, report *Report) ([]*syncEntry, error) {
+	files, err := util.GetProjectFiles(opts.Packages)
+	if err != nil {
+		return nil, err
+	}
+
+	local := make(map[string]interface{})
+	for _, fileInfo := range files {
+		if !opts.Files.Match(fileInfo.Path) || isCertFile(fileInfo.Path) {
+			log.DbgLogger2.Println("file ignored:", fileInfo.Path)
+			continue
+		}
+
+		local[fileInfo.Path] = fileInfo
+	}
+
+	report.phase(PhaseListFiles)
+
+	files, err = remoteFiles(ctx, dp, opts.Files, opts.Packages)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := make(map[string]interface{})
+	for _, fileInfo := range files {
+		remote[fileInfo.Path] = fileInfo
+	}
+
+	report.phase(PhaseDiffFiles)
+
+	entries := syncEntries(KindFile, diffEntries(local, remote))
+	if err := localCopies(opts.Packages, entries); err != nil {
+		return nil, err
+	}
+
+	hashFn := func(e *syncEntry) (err error) {
+		if e.local != nil {
+			if e.localHash, err = localFileHash(e.local.(*util.FileInfo)); err != nil {
+				return err
+			}
+		}
+
+		if e.remote != nil {
+			e.remoteHash, err = remoteFileHash(rctx, dp, e.name)
+		}
+
+		return err
+	}
+
+	if errCount := hashEntries(ctx, entries, hashFn, sem, n, report); errCount > 0 {
+		return entries, fmt.Errorf("failed to compare %v files", errCount)
+	}
+
+	return entries, nil
+}
+
+// syncObjectEntries lists and hashes the local and the remote objects
+func syncObjectEntries(ctx, rctx context.Context, dp util.DataPower, opts *SyncOptions, sem *semaphore.Weighted, n int64, report *Report) ([]*syncEntry, error) {
+	objects, err := util.GetProjectObjects(opts.Packages)
+	if err != nil {
+		return nil, err
+	}
+
+	local := make(map[string]interface{})
+	for _, objInfo := range objects {
+		qn := objInfo.QName()
+
+		if !opts.Objects.Match(qn) {
+			log.DbgLogger2.Println("object ignored:", qn)
+			continue
+		}
+
+		local[qn] = objInfo
+	}
+
+	report.phase(PhaseListObjects)
+
+	objects, err = remoteObjects(ctx, dp, opts.Objects, opts.Packages)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := make(map[string]interface{})
+	for _, objInfo := range objects {
+		remote[objInfo.QName()] = objInfo
+	}
+
+	report.phase(PhaseDiffObjects)
+
+	entries := syncEntries(KindObject, diffEntries(local, remote))
+	if err := localCopies(opts.Packages, entries); err != nil {
+		return nil, err
+	}
+
+	hashFn := func(e *syncEntry) (err error) {
+		if e.local != nil {
+			if e.localHash, err = localObjectHash(e.local.(*util.ObjectInfo), opts.Normalizer); err != nil {
+				return err
+			}
+		}
+
+		if e.remote != nil {
+			e.remoteHash, err = remoteObjectHash(rctx, dp, e.remote.(*util.ObjectInfo), syncPackage(e), opts.Normalizer)
+		}
+
+		return err
+	}
+
+	if errCount := hashEntries(ctx, entries, hashFn, sem, n, report); errCount > 0 {
+		return entries, fmt.Errorf("failed to compare %v objects", errCount)
+	}
+
+	return entries, nil
+}
+
+func syncEntries(kind Kind, entries []*diffEntry) []*syncEntry {
+	var res []*syncEntry
+	for _, e := range entries {
+		res = append(res, &syncEntry{diffEntry: e, kind: kind})
+	}
+
+	return res
+}
+
+// localCopies sets the copies of the local entry items, the object and patch files of
+// an object or the files of a file in every package
+func localCopies(pkgs util.PackageSlice, entries []*syncEntry) error {
+	for _, e := range entries {
+		if e.local == nil {
+			continue
+		}
+
+		var names []string
+		if e.kind == KindFile {
+			names = []string{filepath.Join("files", filepath.FromSlash(e.name))}
+		} else {
+			cls, name := splitQName(e.name)
+			names = []string{
+				filepath.Join("objects", cls, name+".json"),
+				filepath.Join("objects", cls, name+util.PatchExt),
+			}
+		}
+
+		for _, pkg := range pkgs {
+			for _, n := range names {
+				f := filepath.Join(pkg.Dir, n)
+
+				_, err := os.Stat(f)
+				if os.IsNotExist(err) {
+					continue
+				}
+
+				if err != nil {
+					return err
+				}
+
+				e.copies = append(e.copies, f)
+				e.imported = e.imported || pkg.External
+			}
+		}
+	}
+
+	return nil
+}
+
+// syncPackage returns the package whose format applies to the entry object
+func syncPackage(e *syncEntry) *util.Package {
+	if e.local != nil {
+		return e.local.(*util.ObjectInfo).Package
+	}
+
+	return e.remote.(*util.ObjectInfo).Package
+}
+
+// hashEntries hashes the entries concurrently, the failed entries are reported
+// as ERROR and returned as failed
+func hashEntries(ctx context.Context, entries []*syncEntry, hashFn func(e *syncEntry) error, sem *semaphore.Weighted, n int64, report *Report) uint64 {
+	var errCount uint64
+
+	for _, e := range entries {
+		if err := acquireItem(ctx, sem); err != nil {
+			break
+		}
+
+		go func(e *syncEntry) {
+			defer sem.Release(1)
+
+			start := time.Now()
+			if err := hashFn(e); err != nil {
+				e.failed = true
+				atomic.AddUint64(&errCount, 1)
+				report.add(e.item(), StatusError, err, start)
+			}
+		}(e)
+	}
+
+	waitItems(sem, n)
+
+	return atomic.LoadUint64(&errCount)
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func localFileHash(fileInfo *util.FileInfo) (string, error) {
+	data, err := fileInfo.Data()
+	if err != nil {
+		return "", err
+	}
+
+	return hashBytes(data), nil
+}
+
+func remoteFileHash(ctx context.Context, dp util.DataPower, path string) (string, error) {
+	data, err := dp.GetFile(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	return hashBytes(data), nil
+}
+
+// objectHash hashes the canonical JSON of the object without its links,
+// normalized and with the order-insensitive arrays sorted
+func objectHash(cls string, obj interface{}, pkg *util.Package, normalizer *util.Normalizer) (string, error) {
+	deleteLinks(obj.(util.GenericMap))
+
+	if normalizer != nil {
+		if err := normalizer.Normalize(cls, obj.(util.GenericMap)); err != nil {
+			return "", err
+		}
+	}
+
+	if pkg != nil {
+		pkg.ObjectFormat().SortArrays(cls, obj)
+	}
+
+	data, err := util.FormatJSON(obj, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return hashBytes(data), nil
+}
+
+func localObjectHash(objInfo *util.ObjectInfo, normalizer *util.Normalizer) (string, error) {
+	obj, err := objInfo.ReadData()
+	if err != nil {
+		return "", err
+	}
+
+	return objectHash(objInfo.Class, obj, objInfo.Package, normalizer)
+}
+
+func remoteObjectHash(ctx context.Context, dp util.DataPower, objInfo *util.ObjectInfo, pkg *util.Package, normalizer *util.Normalizer) (string, error) {
+	obj, err := getRemoteObject(ctx, dp, objInfo)
+	if err != nil {
+		return "", err
+	}
+
+	return objectHash(objInfo.Class, obj, pkg, normalizer)
+}
+
+// updateSyncState records the hashes of the entries synchronized successfully,
+// the hash of the side that changed is computed again
+func updateSyncState(ctx context.Context, dp util.DataPower, opts *SyncOptions, entries []*syncEntry, results map[Item]Status, state map[string]*syncHashes) {
+	var objects map[string]*util.ObjectInfo
+	var files map[string]*util.FileInfo
+
+	for _, e := range entries {
+		if e.action == syncNone || e.action == syncConflict {
+			continue
+		}
+
+		if e.action != syncSame && !results[Item{Kind: e.kind, Name: e.name}].Completed() {
+			continue
+		}
+
+		var err error
+		hashes := &syncHashes{Local: e.localHash, Remote: e.remoteHash}
+
+		switch e.action {
+		case syncDeleteRemote, syncDeleteLocal:
+			delete(state, e.name)
+			continue
+		case syncPush:
+			if e.kind == KindFile {
+				hashes.Remote, err = remoteFileHash(ctx, dp, e.name)
+			} else {
+				objInfo := e.local.(*util.ObjectInfo)
+				hashes.Remote, err = remoteObjectHash(ctx, dp, &util.ObjectInfo{Class: objInfo.Class, Name: objInfo.Name}, objInfo.Package, opts.Normalizer)
+			}
+		case syncPull:
+			if objects == nil {
+				objects, files, err = projectItems(opts.Packages)
+				if err != nil {
+					break
+				}
+			}
+
+			if e.kind == KindFile {
+				if fileInfo, ok := files[e.name]; ok {
+					hashes.Local, err = localFileHash(fileInfo)
+				} else {
+					err = fmt.Errorf("pulled file not found")
+				}
+			} else {
+				if objInfo, ok := objects[e.name]; ok {
+					hashes.Local, err = localObjectHash(objInfo, opts.Normalizer)
+				} else {
+					err = fmt.Errorf("pulled object not found")
+				}
+			}
+		}
+
+		if err != nil {
+			// without state the item is a conflict on the next sync unless both sides are identical
+			log.DbgLogger1.Printf("sync state of %s not recorded: %v", e.name, err)
+			continue
+		}
+
+		state[e.name] = hashes
+	}
+}
+
+// projectItems returns the project objects by qualified name and files by path
+func projectItems(pkgs util.PackageSlice) (map[string]*util.ObjectInfo, map[string]*util.FileInfo, error) {
+	objects, err := util.GetProjectObjects(pkgs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := util.GetProjectFiles(pkgs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objMap := make(map[string]*util.ObjectInfo)
+	for _, objInfo := range objects {
+		objMap[objInfo.QName()] = objInfo
+	}
+
+	fileMap := make(map[string]*util.FileInfo)
+	for _, fileInfo := range files {
+		fileMap[fileInfo.Path] = fileInfo
+	}
+
+	return objMap, fileMap, nil
+}
+
+// writeConflict writes the remote version of a conflicting item in the conflicts
+// directory, under the package of the item
+func writeConflict(ctx context.Context, dp util.DataPower, opts *SyncOptions, e *syncEntry) error {
+	pkg := e.item().Package
+	if pkg == "" {
+		pkg = "unrouted"
+	}
+
+	if e.kind == KindFile {
+		data, err := dp.GetFile(ctx, e.name)
+		if err != nil {
+			return err
+		}
+
+		return writeConflictFile(filepath.Join(opts.ConflictsDir, pkg, "files", filepath.FromSlash(e.name)), data)
+	}
+
+	objInfo := e.remote.(*util.ObjectInfo)
+
+	obj, err := getRemoteObject(ctx, dp, objInfo)
+	if err != nil {
+		return err
+	}
+
+	if opts.Normalizer != nil {
+		if err := opts.Normalizer.Normalize(objInfo.Class, obj.(util.GenericMap)); err != nil {
+			return err
+		}
+	}
+
+	data, err := util.FormatJSON(obj, util.DefaultIndent)
+	if p := syncPackage(e); p != nil {
+		data, err = p.ObjectFormat().FormatObject(objInfo.Class, obj)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return writeConflictFile(filepath.Join(opts.ConflictsDir, pkg, "objects", objInfo.Class, objInfo.Name+".json"), data)
+}
+
+func writeConflictFile(f string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(f, data, 0644)
+}
+
+// readSyncState reads the state file, a missing file is an empty state
+func readSyncState(file string) (*syncState, error) {
+	state := &syncState{
+		Objects: make(map[string]*syncHashes),
+		Files:   make(map[string]*syncHashes),
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid sync state file %s: %v", file, err)
+	}
+
+	if state.Objects == nil {
+		state.Objects = make(map[string]*syncHashes)
+	}
+
+	if state.Files == nil {
+		state.Files = make(map[string]*syncHashes)
+	}
+
+	return state, nil
+}
+
+func writeSyncState(file string, state *syncState) error {
+	data, err := util.FormatJSON(state, util.DefaultIndent)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, data, 0644)
+}
@@ -0,0 +1,198 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lfeier/dpctl/log"
+	"github.com/lfeier/dpctl/util"
+)
+
+// DefaultDebounce is the default quiet period after a change before pushing
+const DefaultDebounce = 500 * time.Millisecond
+
+// WatchOptions are the options of Watch
+type WatchOptions struct {
+	// Push are the options of each push, Changes is set to the items changed since
+	// the previous push
+	Push PushOptions
+	// Debounce is the quiet period after the last change of a burst before pushing
+	Debounce time.Duration
+	// Watching is called once the package directories are watched
+	Watching func()
+	// Pushed receives the report and the error of each push
+	Pushed func(report *Report, err error)
+}
+
+// Watch watches the objects and files directories of the packages and pushes the
+// items changed after each burst of changes, until ctx is cancelled; the push
+// failures are passed to Pushed and do not stop the watch
+func Watch(ctx context.Context, dp util.DataPower, opts *WatchOptions) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// the package directories are watched for their objects and files directories
+	// created after the start
+	pkgDirs := make(map[string]bool)
+	for _, pkg := range opts.Push.Packages {
+		pkgDirs[filepath.Clean(pkg.Dir)] = true
+
+		log.DbgLogger3.Println("watching directory:", pkg.Dir)
+
+		if err := watcher.Add(pkg.Dir); err != nil {
+			return err
+		}
+
+		for _, dir := range []string{"objects", "files"} {
+			if err := watchDir(watcher, filepath.Join(pkg.Dir, dir), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.Watching != nil {
+		opts.Watching()
+	}
+
+	debounce := opts.Debounce
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+
+	// the domain is created by the first push only
+	pushOpts := opts.Push
+
+	changed := make(map[string]bool)
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Op == fsnotify.Chmod || util.IsHidden(event.Name) {
+				continue
+			}
+
+			if base := filepath.Base(event.Name); pkgDirs[filepath.Dir(event.Name)] && base != "objects" && base != "files" {
+				continue
+			}
+
+			log.DbgLogger3.Printf("watch event: %s %s", event.Op, event.Name)
+
+			if event.Op&fsnotify.Create != 0 {
+				// the files created in a new directory before it is watched are changes too
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+					if err := watchDir(watcher, event.Name, changed); err != nil {
+						return err
+					}
+				}
+			}
+
+			changed[event.Name] = true
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			return fmt.Errorf("watch failed: %v", err)
+
+		case <-timer.C:
+			changes := util.NewProjectChanges()
+			for path := range changed {
+				_, err := os.Stat(path)
+				changes.Add(opts.Push.Packages, os.IsNotExist(err), path)
+			}
+
+			changed = make(map[string]bool)
+
+			if changes.Empty() {
+				continue
+			}
+
+			pushOpts.Changes = changes
+
+			report, err := Push(ctx, dp, &pushOpts)
+			pushOpts.CreateDomain = false
+
+			if opts.Pushed != nil {
+				opts.Pushed(report, err)
+			}
+
+			if err == ErrInterrupted {
+				return nil
+			}
+		}
+	}
+}
+
+// watchDir watches a directory and its subdirectories, the files found are added
+// to changed when not nil; a missing directory is ignored
+func watchDir(watcher *fsnotify.Watcher, dir string, changed map[string]bool) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != dir && util.IsHidden(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.IsDir() {
+			if changed != nil {
+				changed[path] = true
+			}
+
+			return nil
+		}
+
+		log.DbgLogger3.Println("watching directory:", path)
+
+		return watcher.Add(path)
+	})
+}
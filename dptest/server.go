@@ -0,0 +1,739 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dptest provides an in-memory DataPower REST management server for tests
+package dptest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lfeier/dpctl/util"
+)
+
+// Stores are the file stores of every domain
+var Stores = []string{"local", "store", "cert", "sharedcert", "pubcert"}
+
+// FirmwareVersion is the firmware version reported by the server
+const FirmwareVersion = "IDG.2018.4.1.0"
+
+// ActionFunc handles an action queue request, params are the action parameters
+type ActionFunc func(domain string, params util.GenericMap) (interface{}, error)
+
+// Server is an in-memory DataPower REST management server
+type Server struct {
+	*httptest.Server
+
+	UserName string
+	Password string
+
+	mutex    sync.Mutex
+	domains  map[string]*domainState
+	actions  map[string]ActionFunc
+	async    map[string]int
+	pending  map[string]*pendingAction
+	latency  time.Duration
+	failures []*failure
+	requests []string
+}
+
+type domainState struct {
+	objects map[string]util.GenericMap
+	dirs    map[string]bool
+	files   map[string][]byte
+}
+
+// pendingAction is an asynchronous action completed after a number of status polls
+type pendingAction struct {
+	polls  int
+	result interface{}
+	err    error
+}
+
+type failure struct {
+	method     string
+	prefix     string
+	statusCode int
+	count      int
+}
+
+// NewServer starts a TLS server with the "default" domain accepting the given credentials
+func NewServer(userName, password string) *Server {
+	s := &Server{
+		UserName: userName,
+		Password: password,
+		domains:  make(map[string]*domainState),
+		actions:  make(map[string]ActionFunc),
+		async:    make(map[string]int),
+		pending:  make(map[string]*pendingAction),
+	}
+
+	s.AddDomain("default")
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// AddDomain creates an empty application domain
+func (s *Server) AddDomain(domain string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.addDomain(domain)
+}
+
+func (s *Server) addDomain(domain string) {
+	if _, ok := s.domains[domain]; ok {
+		return
+	}
+
+	d := &domainState{
+		objects: make(map[string]util.GenericMap),
+		dirs:    make(map[string]bool),
+		files:   make(map[string][]byte),
+	}
+
+	for _, store := range Stores {
+		d.dirs[store] = true
+	}
+
+	s.domains[domain] = d
+}
+
+// SetObject stores a configuration object
+func (s *Server) SetObject(domain, class string, obj util.GenericMap) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.addDomain(domain)
+	s.domains[domain].objects[util.ObjectQName(class, obj["name"].(string))] = obj
+}
+
+// Object returns a configuration object, nil if it does not exist
+func (s *Server) Object(domain, class, name string) util.GenericMap {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.domains[domain]
+	if !ok {
+		return nil
+	}
+
+	return d.objects[util.ObjectQName(class, name)]
+}
+
+// SetFile stores a file creating its directories
+func (s *Server) SetFile(domain, p string, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.addDomain(domain)
+	d := s.domains[domain]
+
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		d.dirs[dir] = true
+	}
+
+	d.files[p] = data
+}
+
+// File returns the content of a file and whether it exists
+func (s *Server) File(domain, p string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.domains[domain]
+	if !ok {
+		return nil, false
+	}
+
+	data, ok := d.files[p]
+	return data, ok
+}
+
+// Dir reports whether a file store directory exists
+func (s *Server) Dir(domain, p string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.domains[domain]
+	if !ok {
+		return false
+	}
+
+	return d.dirs[p]
+}
+
+// SetAction registers the handler of an action queue operation
+func (s *Server) SetAction(name string, fn ActionFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.actions[name] = fn
+}
+
+// SetAsyncAction registers the handler of an asynchronous action queue operation,
+// its status is "processing" for the given number of polls before completing
+func (s *Server) SetAsyncAction(name string, polls int, fn ActionFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.actions[name] = fn
+	s.async[name] = polls
+}
+
+// SetLatency delays every response
+func (s *Server) SetLatency(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.latency = d
+}
+
+// Fail answers the next count requests matching the method and the path prefix
+// with the given status code, an empty method matches all methods
+func (s *Server) Fail(method, prefix string, statusCode, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures = append(s.failures, &failure{
+		method:     method,
+		prefix:     prefix,
+		statusCode: statusCode,
+		count:      count,
+	})
+}
+
+// Requests returns the requests received as "METHOD path"
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	latency := s.latency
+	statusCode := s.injectedFailure(r)
+	s.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if u, p, ok := r.BasicAuth(); !ok || u != s.UserName || p != s.Password {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "<html><body><h1>401 Authentication failure</h1></body></html>")
+		return
+	}
+
+	if statusCode != 0 {
+		writeError(w, statusCode, fmt.Sprintf("Injected failure: %s", http.StatusText(statusCode)))
+		return
+	}
+
+	var rqBody util.GenericMap
+	if r.Body != nil && (r.Method == "PUT" || r.Method == "POST") {
+		if err := json.NewDecoder(r.Body).Decode(&rqBody); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(p) < 2 || p[0] != "mgmt" {
+		writeError(w, http.StatusNotFound, "Resource not found.")
+		return
+	}
+
+	switch p[1] {
+	case "config":
+		s.serveConfig(w, r.Method, p[2:], rqBody)
+	case "filestore":
+		s.serveFileStore(w, r.Method, p[2:], rqBody)
+	case "status":
+		s.serveStatus(w, r.Method, p[2:])
+	case "actionqueue":
+		s.serveActionQueue(w, r.Method, p[2:], rqBody)
+	default:
+		writeError(w, http.StatusNotFound, "Resource not found.")
+	}
+}
+
+// injectedFailure returns the status code of the failure matching the request, 0 if none
+func (s *Server) injectedFailure(r *http.Request) int {
+	for _, f := range s.failures {
+		if f.count > 0 && (f.method == "" || f.method == r.Method) && strings.HasPrefix(r.URL.Path, f.prefix) {
+			f.count--
+			return f.statusCode
+		}
+	}
+
+	return 0
+}
+
+func (s *Server) domain(w http.ResponseWriter, name string) *domainState {
+	d, ok := s.domains[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Domain %s does not exist.", name))
+	}
+
+	return d
+}
+
+func (s *Server) serveConfig(w http.ResponseWriter, method string, p []string, rqBody util.GenericMap) {
+	if len(p) == 0 {
+		links := util.GenericMap{"self": util.GenericMap{"href": "/mgmt/config/"}}
+		for _, d := range s.domains {
+			for qn := range d.objects {
+				cls := strings.SplitN(qn, "/", 2)[0]
+				links[cls] = util.GenericMap{"href": fmt.Sprintf("/mgmt/config/{domain}/%s", cls)}
+			}
+		}
+
+		writeJSON(w, http.StatusOK, util.GenericMap{"_links": links})
+		return
+	}
+
+	d := s.domain(w, p[0])
+	if d == nil {
+		return
+	}
+
+	switch {
+	case len(p) == 2 && method == "GET":
+		var objs util.GenericArray
+		for _, qn := range sortedKeys(d.objects) {
+			if strings.HasPrefix(qn, p[1]+"/") {
+				objs = append(objs, d.objects[qn])
+			}
+		}
+
+		rsBody := util.GenericMap{}
+		switch len(objs) {
+		case 0:
+		case 1:
+			rsBody[p[1]] = objs[0]
+		default:
+			rsBody[p[1]] = objs
+		}
+
+		writeJSON(w, http.StatusOK, rsBody)
+	case len(p) == 3 && method == "GET":
+		obj, ok := d.objects[util.ObjectQName(p[1], p[2])]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Resource %s/%s not found.", p[1], p[2]))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, util.GenericMap{p[1]: obj})
+	case len(p) == 3 && method == "PUT":
+		obj, ok := rqBody[p[1]].(util.GenericMap)
+		if !ok || obj["name"] != p[2] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s object: %s", p[1], p[2]))
+			return
+		}
+
+		qn := util.ObjectQName(p[1], p[2])
+		result := "Configuration was created."
+		if _, ok := d.objects[qn]; ok {
+			result = "Configuration was updated."
+		}
+
+		d.objects[qn] = obj
+
+		if p[0] == "default" && p[1] == "Domain" {
+			s.addDomain(p[2])
+		}
+
+		status := http.StatusOK
+		if result == "Configuration was created." {
+			status = http.StatusCreated
+		}
+
+		writeJSON(w, status, util.GenericMap{p[2]: result})
+	case len(p) == 3 && method == "DELETE":
+		qn := util.ObjectQName(p[1], p[2])
+		if _, ok := d.objects[qn]; !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Resource %s/%s not found.", p[1], p[2]))
+			return
+		}
+
+		// like DataPower an object still referenced cannot be deleted
+		for _, other := range sortedKeys(d.objects) {
+			for _, dep := range util.Depend(d.objects[other]) {
+				if dep == qn {
+					writeError(w, http.StatusBadRequest, fmt.Sprintf("Cannot delete %s, it is referenced by %s.", qn, other))
+					return
+				}
+			}
+		}
+
+		delete(d.objects, qn)
+		writeJSON(w, http.StatusOK, util.GenericMap{p[2]: "Configuration was deleted."})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+}
+
+func (s *Server) serveFileStore(w http.ResponseWriter, method string, p []string, rqBody util.GenericMap) {
+	if len(p) == 0 {
+		writeError(w, http.StatusNotFound, "Resource not found.")
+		return
+	}
+
+	d := s.domain(w, p[0])
+	if d == nil {
+		return
+	}
+
+	if len(p) == 1 {
+		var locations util.GenericArray
+		for _, store := range Stores {
+			locations = append(locations, util.GenericMap{"name": store + ":"})
+		}
+
+		writeJSON(w, http.StatusOK, util.GenericMap{"filestore": util.GenericMap{"location": locations}})
+		return
+	}
+
+	fp := strings.Join(p[1:], "/")
+
+	switch method {
+	case "GET":
+		if _, ok := d.files[fp]; ok && isCertStore(fp) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("Cannot read from file %s.", fp))
+			return
+		}
+
+		if data, ok := d.files[fp]; ok {
+			writeJSON(w, http.StatusOK, util.GenericMap{"file": base64.StdEncoding.EncodeToString(data)})
+			return
+		}
+
+		if !d.dirs[fp] {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Path %s not found.", fp))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, util.GenericMap{"filestore": util.GenericMap{"location": d.list(fp)}})
+	case "PUT":
+		if !d.dirs[path.Dir(fp)] {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Directory %s not found.", path.Dir(fp)))
+			return
+		}
+
+		if _, ok := rqBody["directory"]; ok {
+			if d.dirs[fp] {
+				writeError(w, http.StatusConflict, fmt.Sprintf("Directory %s already exists.", fp))
+				return
+			}
+
+			d.dirs[fp] = true
+			writeJSON(w, http.StatusCreated, util.GenericMap{"result": "Directory was created."})
+			return
+		}
+
+		content, _ := util.JSONValue(rqBody, "file", "content").(string)
+		data, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		result := "File was created."
+		status := http.StatusCreated
+		if _, ok := d.files[fp]; ok {
+			result = "File was updated."
+			status = http.StatusOK
+		}
+
+		d.files[fp] = data
+		writeJSON(w, status, util.GenericMap{"result": result})
+	case "DELETE":
+		if d.dirs[fp] {
+			// like DataPower, a directory is deleted with its content
+			for p := range d.dirs {
+				if p == fp || strings.HasPrefix(p, fp+"/") {
+					delete(d.dirs, p)
+				}
+			}
+
+			for p := range d.files {
+				if strings.HasPrefix(p, fp+"/") {
+					delete(d.files, p)
+				}
+			}
+
+			writeJSON(w, http.StatusOK, util.GenericMap{"result": "ok"})
+			return
+		}
+
+		if _, ok := d.files[fp]; !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("File %s not found.", fp))
+			return
+		}
+
+		delete(d.files, fp)
+		writeJSON(w, http.StatusOK, util.GenericMap{"result": "ok"})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+}
+
+// list returns the file store location of a directory
+func (d *domainState) list(dir string) util.GenericMap {
+	store := strings.SplitN(dir, "/", 2)[0]
+
+	var dirs, files util.GenericArray
+	for _, p := range sortedKeys(d.dirs) {
+		if path.Dir(p) == dir {
+			dirs = append(dirs, util.GenericMap{"name": fmt.Sprintf("%s:/%s", store, strings.TrimPrefix(p, store+"/"))})
+		}
+	}
+
+	for _, p := range sortedKeys(d.files) {
+		if path.Dir(p) == dir {
+			files = append(files, util.GenericMap{
+				"name":     path.Base(p),
+				"size":     float64(len(d.files[p])),
+				"modified": "2018-01-01 00:00:00",
+			})
+		}
+	}
+
+	location := util.GenericMap{"name": fmt.Sprintf("%s:", dir)}
+	if dirs != nil {
+		location["directory"] = dirs
+	}
+
+	if files != nil {
+		location["file"] = files
+	}
+
+	return location
+}
+
+func (s *Server) serveStatus(w http.ResponseWriter, method string, p []string) {
+	if len(p) != 2 || method != "GET" {
+		writeError(w, http.StatusNotFound, "Resource not found.")
+		return
+	}
+
+	d := s.domain(w, p[0])
+	if d == nil {
+		return
+	}
+
+	switch p[1] {
+	case "ObjectStatus":
+		var status util.GenericArray
+		for _, qn := range sortedKeys(d.objects) {
+			cls := strings.SplitN(qn, "/", 2)[0]
+			// a disabled object is down
+			adminState, opState := "enabled", "up"
+			if d.objects[qn]["mAdminState"] == "disabled" {
+				adminState, opState = "disabled", "down"
+			}
+
+			status = append(status, util.GenericMap{
+				"Class":      cls,
+				"Name":       d.objects[qn]["name"],
+				"OpState":    opState,
+				"AdminState": adminState,
+			})
+		}
+
+		// like DataPower a single status is not wrapped in a list
+		rsBody := util.GenericMap{}
+		switch len(status) {
+		case 0:
+		case 1:
+			rsBody["ObjectStatus"] = status[0]
+		default:
+			rsBody["ObjectStatus"] = status
+		}
+
+		writeJSON(w, http.StatusOK, rsBody)
+	case "FirmwareVersion3":
+		writeJSON(w, http.StatusOK, util.GenericMap{"FirmwareVersion3": util.GenericMap{"Version": FirmwareVersion}})
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Status provider %s not found.", p[1]))
+	}
+}
+
+func (s *Server) serveActionQueue(w http.ResponseWriter, method string, p []string, rqBody util.GenericMap) {
+	if len(p) == 3 && p[1] == "pending" && method == "GET" {
+		s.serveActionStatus(w, p)
+		return
+	}
+
+	if len(p) != 1 || method != "POST" {
+		writeError(w, http.StatusNotFound, "Resource not found.")
+		return
+	}
+
+	if s.domain(w, p[0]) == nil {
+		return
+	}
+
+	if len(rqBody) != 1 {
+		writeError(w, http.StatusBadRequest, "Exactly one action expected.")
+		return
+	}
+
+	for name, params := range rqBody {
+		fn, ok := s.actions[name]
+		if !ok && name == "CryptoExport" {
+			fn, ok = s.cryptoExport, true
+		}
+
+		if !ok {
+			writeJSON(w, http.StatusOK, util.GenericMap{name: "Operation completed."})
+			return
+		}
+
+		m, _ := params.(util.GenericMap)
+		res, err := fn(p[0], m)
+
+		if polls, ok := s.async[name]; ok {
+			id := fmt.Sprintf("%s-%d", name, len(s.pending)+1)
+			s.pending[id] = &pendingAction{polls: polls, result: res, err: err}
+
+			href := fmt.Sprintf("/mgmt/actionqueue/%s/pending/%s", p[0], id)
+			writeJSON(w, http.StatusAccepted, util.GenericMap{
+				"_links": util.GenericMap{"location": util.GenericMap{"href": href}},
+				name:     util.GenericMap{"status": "Action request accepted."},
+			})
+			return
+		}
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, util.GenericMap{name: res})
+	}
+}
+
+// isCertStore reports whether the file is in a certificate store, their content cannot be read
+func isCertStore(fp string) bool {
+	store := strings.SplitN(fp, "/", 2)[0]
+	return store == "cert" || store == "sharedcert" || store == "pubcert"
+}
+
+// cryptoExport exports the certificate of a CryptoCertificate object to a temporary: file
+func (s *Server) cryptoExport(domain string, params util.GenericMap) (interface{}, error) {
+	d := s.domains[domain]
+
+	name, _ := params["ObjectName"].(string)
+	obj, ok := d.objects["CryptoCertificate/"+name]
+	if params["ObjectType"] != "cert" || !ok {
+		return nil, fmt.Errorf("Certificate %v not found.", params["ObjectName"])
+	}
+
+	url, _ := obj["Filename"].(string)
+	data, ok := d.files[strings.Replace(url, ":///", "/", 1)]
+	if !ok {
+		return nil, fmt.Errorf("File %s not found.", url)
+	}
+
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("Invalid certificate %s.", url)
+	}
+
+	out, _ := params["OutputFilename"].(string)
+	d.files["temporary/"+out] = []byte(fmt.Sprintf("<crypto-export><certificate name=\"%s\" type=\"cert\">%s</certificate></crypto-export>", name, base64.StdEncoding.EncodeToString(b.Bytes)))
+
+	return "Operation completed.", nil
+}
+
+func (s *Server) serveActionStatus(w http.ResponseWriter, p []string) {
+	a, ok := s.pending[p[2]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found.")
+		return
+	}
+
+	links := util.GenericMap{"self": util.GenericMap{"href": fmt.Sprintf("/mgmt/actionqueue/%s/pending/%s", p[0], p[2])}}
+
+	switch {
+	case a.polls > 0:
+		a.polls--
+		writeJSON(w, http.StatusOK, util.GenericMap{"_links": links, "status": "processing"})
+	case a.err != nil:
+		writeJSON(w, http.StatusOK, util.GenericMap{"_links": links, "status": "error", "error": []string{a.err.Error()}})
+	default:
+		writeJSON(w, http.StatusOK, util.GenericMap{"_links": links, "status": "completed", "result": a.result})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, msg string) {
+	writeJSON(w, statusCode, util.GenericMap{"error": []string{msg}})
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+
+	switch t := m.(type) {
+	case map[string]util.GenericMap:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]bool:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string][]byte:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// NewClient returns a client of the server operating in the given domain
+func (s *Server) NewClient(domain string) *util.Client {
+	return util.NewClient(s.Client(), s.URL, s.UserName, s.Password, domain)
+}
@@ -15,7 +15,10 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/lfeier/dpctl/cmd"
@@ -34,7 +37,22 @@ func main() {
 		log.DbgLogger1.Printf("Total time: %v", time.Since(start))
 	}(time.Now())
 
-	if err := cmd.CmdRoot.Execute(); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		s := <-signals
+		log.ErrLogger.Printf("Received %v, stopping (repeat to exit immediately)", s)
+		cancel()
+
+		<-signals
+		os.Exit(130)
+	}()
+
+	if err := cmd.ExecuteContext(ctx); err != nil {
 		log.ErrLogger.Println(err.Error())
 		os.Exit(1)
 	}
@@ -0,0 +1,197 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/lfeier/dpctl/log"
+)
+
+// ProjectChanges are the project objects and files changed since a git revision
+type ProjectChanges struct {
+	// Objects are the qualified names of the objects with an added, modified or
+	// removed object or patch file
+	Objects map[string]bool
+	// Files are the paths of the added, modified or removed files
+	Files map[string]bool
+	// RemovedObjects are the qualified names of the objects with a removed object file
+	RemovedObjects map[string]bool
+	// RemovedFiles are the paths of the removed files
+	RemovedFiles map[string]bool
+	// RemovedData are the last committed data of the removed objects, when known
+	RemovedData map[string]interface{}
+}
+
+// NewProjectChanges returns empty project changes
+func NewProjectChanges() *ProjectChanges {
+	return &ProjectChanges{
+		Objects:        make(map[string]bool),
+		Files:          make(map[string]bool),
+		RemovedObjects: make(map[string]bool),
+		RemovedFiles:   make(map[string]bool),
+		RemovedData:    make(map[string]interface{}),
+	}
+}
+
+// Empty reports whether no object and no file changed
+func (pc *ProjectChanges) Empty() bool {
+	return len(pc.Objects) == 0 && len(pc.Files) == 0
+}
+
+// gitChange is a path changed in the git working tree, relative to the git command directory
+type gitChange struct {
+	status string
+	path   string
+}
+
+// GitProjectChanges returns the changes of the package objects and files between a git
+// revision and the working tree of the project directory, the untracked files are added
+// files; the packages outside the project directory are not inspected
+func GitProjectChanges(projectDir string, rev string, pkgs PackageSlice) (*ProjectChanges, error) {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := git(dir, "diff", "--name-status", "--no-renames", "--relative", "-z", rev, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []gitChange
+
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes = append(changes, gitChange{status: fields[i], path: fields[i+1]})
+	}
+
+	out, err = git(dir, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range strings.Split(strings.TrimSuffix(out, "\x00"), "\x00") {
+		if p != "" {
+			changes = append(changes, gitChange{status: "A", path: p})
+		}
+	}
+
+	pc := NewProjectChanges()
+
+	for _, c := range changes {
+		log.DbgLogger2.Printf("git change: %s %s", c.status, c.path)
+
+		qn := pc.add(pkgs, c.status == "D", filepath.Join(dir, filepath.FromSlash(c.path)))
+		if qn == "" {
+			continue
+		}
+
+		// the references of a removed object order its deletion
+		out, err := git(dir, "show", fmt.Sprintf("%s:./%s", rev, c.path))
+		if err != nil {
+			return nil, err
+		}
+
+		var data interface{}
+		if err := json.Unmarshal([]byte(out), &data); err != nil {
+			log.DbgLogger2.Printf("removed object %s not parsed: %v", qn, err)
+			continue
+		}
+
+		pc.RemovedData[qn] = data
+	}
+
+	return pc, nil
+}
+
+// Add records the change of an absolute project path, the paths outside the package
+// objects and files directories are ignored
+func (pc *ProjectChanges) Add(pkgs PackageSlice, removed bool, path string) {
+	pc.add(pkgs, removed, path)
+}
+
+// add records the change of a path and returns the qualified name of the object
+// if path is a removed object file, an empty string otherwise
+func (pc *ProjectChanges) add(pkgs PackageSlice, removed bool, path string) string {
+	for _, pkg := range pkgs {
+		rel, err := filepath.Rel(pkg.Dir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		p := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+		if len(p) != 2 {
+			return ""
+		}
+
+		switch p[0] {
+		case "objects":
+			op := strings.Split(p[1], "/")
+			if len(op) != 2 || filepath.Ext(op[1]) != ".json" {
+				return ""
+			}
+
+			if strings.HasSuffix(op[1], PatchExt) {
+				pc.Objects[ObjectQName(op[0], strings.TrimSuffix(op[1], PatchExt))] = true
+				return ""
+			}
+
+			qn := ObjectQName(op[0], strings.TrimSuffix(op[1], ".json"))
+			pc.Objects[qn] = true
+			if removed {
+				pc.RemovedObjects[qn] = true
+				return qn
+			}
+		case "files":
+			fp := filepath.FromSlash(p[1])
+			pc.Files[fp] = true
+			if removed {
+				pc.RemovedFiles[fp] = true
+			}
+		}
+
+		return ""
+	}
+
+	return ""
+}
+
+// git runs a git command in a directory and returns its output
+func git(dir string, args ...string) (string, error) {
+	log.DbgLogger2.Println("git", strings.Join(args, " "))
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s failed: %s", args[0], msg)
+		}
+
+		return "", fmt.Errorf("git %s failed: %v", args[0], err)
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,100 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+)
+
+func testGit(t *testing.T, dir string, args ...string) {
+	if _, err := git(dir, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitProjectChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"pkg1/metadata.json":                  `{"priority": 1}`,
+		"pkg1/objects/XMLManager/xm.json":     `{"name": "xm"}`,
+		"pkg1/objects/HTTPUserAgent/ua1.json": `{"name": "ua1"}`,
+		"pkg1/objects/HTTPUserAgent/ua2.json": `{"name": "ua2"}`,
+		"pkg1/files/local/a.xsl":              `<a/>`,
+		"pkg1/files/local/b.xml":              `<b/>`,
+		"pkg2/metadata.json":                  `{"priority": 2}`,
+		"pkg2/objects/HTTPUserAgent/ua1.json": `{"name": "ua1"}`,
+	})
+
+	testGit(t, dir, "init", "-q")
+	testGit(t, dir, "config", "user.name", "test")
+	testGit(t, dir, "config", "user.email", "test@example.com")
+	testGit(t, dir, "add", "-A")
+	testGit(t, dir, "commit", "-q", "-m", "initial")
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"pkg1/objects/XMLManager/xm.json":           `{"name": "xm", "CacheSize": 256}`,
+		"pkg2/objects/HTTPUserAgent/ua2.patch.json": `{"Identifier": "dpctl"}`,
+		"pkg1/files/local/c.xml":                    `<c/>`,
+		"pkg1/readme.txt":                           `readme`,
+	})
+
+	for _, f := range []string{"pkg1/objects/HTTPUserAgent/ua1.json", "pkg1/files/local/b.xml"} {
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkgs, err := ProjectPackages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := GitProjectChanges(dir, "HEAD", pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &ProjectChanges{
+		Objects:        map[string]bool{"XMLManager/xm": true, "HTTPUserAgent/ua1": true, "HTTPUserAgent/ua2": true},
+		Files:          map[string]bool{"local/b.xml": true, "local/c.xml": true},
+		RemovedObjects: map[string]bool{"HTTPUserAgent/ua1": true},
+		RemovedFiles:   map[string]bool{"local/b.xml": true},
+		RemovedData:    map[string]interface{}{"HTTPUserAgent/ua1": GenericMap{"name": "ua1"}},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected '%+v', got '%+v'", expected, changes)
+	}
+
+	if _, err := GitProjectChanges(dir, "no-such-rev", pkgs); err == nil {
+		t.Errorf("Expected an unknown revision error")
+	}
+}
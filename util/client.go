@@ -0,0 +1,112 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/lfeier/dpctl/log"
+)
+
+// DataPower is the interface of the DataPower REST management operations
+// used by the commands, it is implemented by Client
+type DataPower interface {
+	// Domain returns the domain of the operations
+	Domain() string
+	// InDomain returns the same connection operating in another domain
+	InDomain(domain string) DataPower
+	// Retries returns the number of retried requests
+	Retries() uint64
+
+	GetObjectClasses(ctx context.Context) ([]string, error)
+	GetObject(ctx context.Context, class, name string) (interface{}, error)
+	IsObject(ctx context.Context, class, name string) (bool, error)
+	GetSingletonObject(ctx context.Context, class string) (interface{}, error)
+	GetObjects(ctx context.Context, class string) ([]interface{}, error)
+	CreateOrUpdateObject(ctx context.Context, cls string, obj interface{}) (interface{}, error)
+	GetFileStores(ctx context.Context) ([]string, error)
+	GetFile(ctx context.Context, path string) ([]byte, error)
+	IsDirectory(ctx context.Context, path string) (bool, error)
+	CreateDirectories(ctx context.Context, path string) error
+	CreateOrUpdateFile(ctx context.Context, path string, data []byte) (interface{}, error)
+	DeleteObject(ctx context.Context, class, name string) error
+	DeleteFile(ctx context.Context, path string) error
+	WalkFileStore(ctx context.Context, path string, walkDirFn WalkDirFunc, walkFileFn WalkFileFunc) error
+	GetStatus(ctx context.Context, statusProvider string) (interface{}, error)
+	GetObjectOpState(ctx context.Context, class, name string) (string, error)
+	GetFirmwareVersion(ctx context.Context) (string, error)
+	GetClassMetadata(ctx context.Context, class string) (interface{}, error)
+	GetTypeMetadata(ctx context.Context, href string) (interface{}, error)
+	ExecuteAction(ctx context.Context, name string, params interface{}) (interface{}, error)
+	GetActionStatus(ctx context.Context, href string) (interface{}, error)
+}
+
+var _ DataPower = (*Client)(nil)
+
+// Client is a DataPower REST management client
+type Client struct {
+	HTTPClient *http.Client
+	// URL is the REST management URL, e.g. https://host:5554
+	URL      string
+	UserName string
+	Password string
+	// DomainName is the domain of the operations
+	DomainName string
+	// RetryPolicy describes how the failed idempotent requests are retried
+	RetryPolicy RetryPolicy
+	// Throttle limits the requests sent to DataPower, nil for no limit
+	Throttle *Throttle
+	// Dump logs the HTTP requests and responses
+	Dump bool
+
+	// retries is shared by the clients returned by InDomain
+	retries *uint64
+}
+
+// NewClient creates a DataPower REST management client without retries and throttling
+func NewClient(httpClient *http.Client, url, userName, password, domain string) *Client {
+	return &Client{
+		HTTPClient: httpClient,
+		URL:        url,
+		UserName:   userName,
+		Password:   password,
+		DomainName: domain,
+		RetryPolicy: RetryPolicy{
+			MaxAttempts: 1,
+		},
+		Dump:    log.DebugLevel >= 5,
+		retries: new(uint64),
+	}
+}
+
+// Domain returns the domain of the operations
+func (c *Client) Domain() string {
+	return c.DomainName
+}
+
+// InDomain returns a client sharing the connection and the policies operating in another domain
+func (c *Client) InDomain(domain string) DataPower {
+	d := *c
+	d.DomainName = domain
+
+	return &d
+}
+
+// Retries returns the number of retried requests
+func (c *Client) Retries() uint64 {
+	return atomic.LoadUint64(c.retries)
+}
@@ -0,0 +1,118 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// HTTPError is returned by Client.Do when DataPower answers with an error status
+type HTTPError struct {
+	// StatusCode is the HTTP status code, e.g. 404
+	StatusCode int
+	// Status is the HTTP status, e.g. "404 Not Found"
+	Status string
+	Method string
+	URL    string
+	// Messages are the error messages reported by DataPower
+	Messages []string
+	// Body is a readable excerpt of the response body when it is not JSON
+	Body string
+}
+
+func (e *HTTPError) Error() string {
+	s := fmt.Sprintf("HTTP response error: %s: %s %s", e.Status, e.Method, e.URL)
+
+	switch {
+	case len(e.Messages) > 0:
+		s = fmt.Sprintf("%s: %s", s, strings.Join(e.Messages, " "))
+	case e.Body != "":
+		s = fmt.Sprintf("%s: %s", s, e.Body)
+	}
+
+	return s
+}
+
+// IsNotFound reports whether err is an HTTP 404 error
+func IsNotFound(err error) bool {
+	return isHTTPStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is an HTTP 409 error
+func IsConflict(err error) bool {
+	return isHTTPStatus(err, http.StatusConflict)
+}
+
+// IsUnauthorized reports whether err is an HTTP 401 error
+func IsUnauthorized(err error) bool {
+	return isHTTPStatus(err, http.StatusUnauthorized)
+}
+
+// ErrorMessages returns the DataPower error messages carried by err
+func ErrorMessages(err error) []string {
+	if e, ok := err.(*HTTPError); ok {
+		return e.Messages
+	}
+
+	return nil
+}
+
+func isHTTPStatus(err error, statusCode int) bool {
+	e, ok := err.(*HTTPError)
+	return ok && e.StatusCode == statusCode
+}
+
+// newHTTPError creates the error of an HTTP response, rsBody is the parsed
+// JSON response or nil if body is not JSON
+func newHTTPError(res *http.Response, rsBody interface{}, body []byte) *HTTPError {
+	e := &HTTPError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Method:     res.Request.Method,
+		URL:        res.Request.URL.String(),
+	}
+
+	if rsBody != nil {
+		for _, m := range JSONArray(JSONValue(rsBody, "error")) {
+			e.Messages = append(e.Messages, fmt.Sprint(m))
+		}
+	} else {
+		e.Body = readableBody(body)
+	}
+
+	return e
+}
+
+var reMarkup = regexp.MustCompile(`<[^>]*>`)
+
+var reSpaces = regexp.MustCompile(`\s+`)
+
+// maxBodyLength is the length in characters of the body excerpt reported in errors
+const maxBodyLength = 200
+
+// readableBody returns the text of an HTML or plain text body on one line
+func readableBody(body []byte) string {
+	s := reMarkup.ReplaceAllString(string(body), " ")
+	s = strings.TrimSpace(reSpaces.ReplaceAllString(s, " "))
+
+	if r := []rune(s); len(r) > maxBodyLength {
+		s = string(r[:maxBodyLength]) + "..."
+	}
+
+	return s
+}
@@ -0,0 +1,82 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "<html>\n  <body><h1>Authentication failure</h1></body>\n</html>")
+		case "/conflict":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": ["Resource not found.", "Check the name."]}`)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.Client(), ts.URL, "", "", "")
+
+	_, err := c.Do(context.Background(), "GET", ts.URL+"/unauthorized", nil)
+	if !IsUnauthorized(err) {
+		t.Fatalf("Expected an unauthorized error, got '%v'", err)
+	}
+
+	expected := fmt.Sprintf("HTTP response error: 401 Unauthorized: GET %s/unauthorized: Authentication failure", ts.URL)
+	if err.Error() != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, err.Error())
+	}
+
+	_, err = c.Do(context.Background(), "PUT", ts.URL+"/conflict", nil)
+	if !IsConflict(err) || IsNotFound(err) {
+		t.Errorf("Expected a conflict error, got '%v'", err)
+	}
+
+	_, err = c.Do(context.Background(), "GET", ts.URL+"/missing", nil)
+	if !IsNotFound(err) {
+		t.Fatalf("Expected a not found error, got '%v'", err)
+	}
+
+	messages := []string{"Resource not found.", "Check the name."}
+	if !reflect.DeepEqual(ErrorMessages(err), messages) {
+		t.Errorf("Expected '%v', got '%v'", messages, ErrorMessages(err))
+	}
+
+	expected = fmt.Sprintf("HTTP response error: 404 Not Found: GET %s/missing: Resource not found. Check the name.", ts.URL)
+	if err.Error() != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, err.Error())
+	}
+}
+
+func TestReadableBody(t *testing.T) {
+	s := readableBody([]byte(strings.Repeat("é", maxBodyLength+1)))
+
+	expected := strings.Repeat("é", maxBodyLength) + "..."
+	if s != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, s)
+	}
+}
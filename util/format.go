@@ -0,0 +1,214 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultIndent is the number of indentation spaces of the project JSON files
+const DefaultIndent = 2
+
+// FormatOptions are the formatting options of the package object files
+type FormatOptions struct {
+	// Indent is the number of indentation spaces, DefaultIndent if not set
+	Indent int `json:"indent"`
+	// Sort are the order-insensitive array properties sorted per class, the
+	// properties of the complex properties as property/subproperty
+	Sort map[string][]string `json:"sort"`
+}
+
+var defaultFormat = &FormatOptions{}
+
+func (o *FormatOptions) check() error {
+	if o.Indent < 0 || o.Indent > 8 {
+		return errors.New("invalid format indent, expected 0 to 8 spaces")
+	}
+
+	return nil
+}
+
+func (o *FormatOptions) indent() int {
+	if o.Indent == 0 {
+		return DefaultIndent
+	}
+
+	return o.Indent
+}
+
+// ObjectFormat returns the formatting options of the package object files
+func (pkg *Package) ObjectFormat() *FormatOptions {
+	if pkg.Format == nil {
+		return defaultFormat
+	}
+
+	return pkg.Format
+}
+
+// FormatJSON returns the canonical JSON of the data: sorted object keys,
+// no HTML escaping and a trailing newline
+func FormatJSON(data interface{}, indent int) ([]byte, error) {
+	var b bytes.Buffer
+
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", strings.Repeat(" ", indent))
+
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// FormatObject sorts the order-insensitive arrays of the object in place
+// and returns the object file content
+func (o *FormatOptions) FormatObject(class string, obj interface{}) ([]byte, error) {
+	o.SortArrays(class, obj)
+
+	return FormatJSON(obj, o.indent())
+}
+
+// FormatPatch returns the patch file content, the patch arrays are never sorted
+func (o *FormatOptions) FormatPatch(patch interface{}) ([]byte, error) {
+	return FormatJSON(patch, o.indent())
+}
+
+// SortArrays sorts in place the order-insensitive arrays of an object by
+// the canonical JSON of their elements
+func (o *FormatOptions) SortArrays(class string, obj interface{}) {
+	for _, p := range o.Sort[class] {
+		sortArray(obj, strings.Split(p, "/"))
+	}
+}
+
+func sortArray(v interface{}, path []string) {
+	m, ok := v.(GenericMap)
+	if !ok {
+		return
+	}
+
+	pv := m[path[0]]
+
+	if len(path) > 1 {
+		switch t := pv.(type) {
+		case GenericMap:
+			sortArray(t, path[1:])
+		case []interface{}:
+			for _, e := range t {
+				sortArray(e, path[1:])
+			}
+		}
+
+		return
+	}
+
+	a, ok := pv.([]interface{})
+	if !ok {
+		return
+	}
+
+	type element struct {
+		key   string
+		value interface{}
+	}
+
+	elements := make([]element, len(a))
+	for i, e := range a {
+		b, _ := FormatJSON(e, 0)
+		elements[i] = element{key: string(b), value: e}
+	}
+
+	sort.SliceStable(elements, func(i, j int) bool {
+		return elements[i].key < elements[j].key
+	})
+
+	for i, e := range elements {
+		a[i] = e.value
+	}
+}
+
+// ObjectFile is an object or an object patch file of a package
+type ObjectFile struct {
+	Class   string
+	Name    string
+	Package *Package
+	File    string
+	// Patch is set for the object patch files
+	Patch bool
+}
+
+// QName returns the qualified name of the object
+func (f *ObjectFile) QName() string {
+	return ObjectQName(f.Class, f.Name)
+}
+
+// PackageObjectFiles returns the object and the patch files of a package, including the
+// objects overridden by other packages; the files not following the project layout are
+// skipped, they are reported by the project scan
+func PackageObjectFiles(pkg *Package) ([]*ObjectFile, error) {
+	objectsDir := filepath.Join(pkg.Dir, "objects")
+
+	dirs, err := ioutil.ReadDir(objectsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var files []*ObjectFile
+	for _, d := range dirs {
+		if !d.IsDir() || IsHidden(d.Name()) {
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(filepath.Join(objectsDir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			n := e.Name()
+			if e.IsDir() || IsHidden(n) || filepath.Ext(n) != ".json" {
+				continue
+			}
+
+			f := &ObjectFile{
+				Class:   d.Name(),
+				Name:    strings.TrimSuffix(n, ".json"),
+				Package: pkg,
+				File:    filepath.Join(objectsDir, d.Name(), n),
+			}
+
+			if strings.HasSuffix(n, PatchExt) {
+				f.Name = strings.TrimSuffix(n, PatchExt)
+				f.Patch = true
+			}
+
+			files = append(files, f)
+		}
+	}
+
+	return files, nil
+}
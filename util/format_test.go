@@ -0,0 +1,144 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+)
+
+func TestFormatObject(t *testing.T) {
+	var obj interface{}
+	err := json.Unmarshal([]byte(`{
+		"name": "xm",
+		"Match": "a<b",
+		"Hosts": ["h2", "h1"],
+		"Rules": [{"Match": "b", "Hosts": ["y", "x"]}, {"Match": "a"}],
+		"Order": [2, 1]
+	}`), &obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &FormatOptions{
+		Indent: 1,
+		Sort: map[string][]string{
+			"XMLManager": {"Hosts", "Rules", "Rules/Hosts"},
+		},
+	}
+
+	b, err := o.FormatObject("XMLManager", obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{
+ "Hosts": [
+  "h1",
+  "h2"
+ ],
+ "Match": "a<b",
+ "Order": [
+  2,
+  1
+ ],
+ "Rules": [
+  {
+   "Hosts": [
+    "x",
+    "y"
+   ],
+   "Match": "b"
+  },
+  {
+   "Match": "a"
+  }
+ ],
+ "name": "xm"
+}
+`
+	if string(b) != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, string(b))
+	}
+
+	b, err = FormatJSON(GenericMap{"b": 1, "a": "&"}, DefaultIndent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "{\n  \"a\": \"&\",\n  \"b\": 1\n}\n"
+	if string(b) != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, string(b))
+	}
+}
+
+func TestPackageFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"app/metadata.json":                     `{"format": {"indent": 4}}`,
+		"app/objects/XMLManager/xm.json":        `{}`,
+		"app/objects/XMLManager/xm2.patch.json": `{}`,
+		"app/objects/XMLManager/.hidden.json":   `{}`,
+		"app/objects/XMLManager/readme.txt":     ``,
+		"app/objects/HTTPUserAgent/ua.json":     `{}`,
+	})
+
+	pkgs, err := LoadPackages(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pkgs[0].ObjectFormat().indent() != 4 {
+		t.Errorf("Expected the package indent, got '%v'", pkgs[0].ObjectFormat().indent())
+	}
+
+	files, err := PackageObjectFiles(pkgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range files {
+		name := f.QName()
+		if f.Patch {
+			name += " patch"
+		}
+
+		names = append(names, name)
+	}
+
+	expected := "HTTPUserAgent/ua,XMLManager/xm,XMLManager/xm2 patch"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, names)
+	}
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"app/metadata.json": `{"format": {"indent": 10}}`,
+	})
+
+	if _, err := LoadPackages(dir, ""); err == nil || !strings.HasPrefix(err.Error(), "package app: invalid format indent") {
+		t.Errorf("Expected an invalid indent error, got '%v'", err)
+	}
+}
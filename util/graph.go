@@ -0,0 +1,245 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lfeier/dpctl/log"
+)
+
+// ObjectGraph is the dependency graph of a set of objects
+type ObjectGraph struct {
+	// Nodes maps the object qualified names to the objects,
+	// the referenced objects not in the set are mapped to nil
+	Nodes map[string]*ObjectInfo
+	// Edges maps the object qualified names to the qualified names of their dependencies
+	Edges map[string][]string
+}
+
+// NewObjectGraph builds the dependency graph of the objects,
+// the objects failing to load are added without dependencies
+func NewObjectGraph(objects ObjectInfoSlice) *ObjectGraph {
+	g := &ObjectGraph{
+		Nodes: make(map[string]*ObjectInfo),
+		Edges: make(map[string][]string),
+	}
+
+	for _, objInfo := range objects {
+		g.Nodes[objInfo.QName()] = objInfo
+	}
+
+	for _, objInfo := range objects {
+		depend, err := objInfo.Depend()
+		if err != nil {
+			log.DbgLogger2.Printf("object dependencies ignored: %s, %s", objInfo.QName(), err.Error())
+		}
+
+		m := make(map[string]bool)
+		for _, qn := range depend {
+			m[qn] = true
+		}
+
+		s := make([]string, 0, len(m))
+		for qn := range m {
+			s = append(s, qn)
+
+			if _, ok := g.Nodes[qn]; !ok {
+				g.Nodes[qn] = nil
+			}
+		}
+
+		sort.Strings(s)
+
+		g.Edges[objInfo.QName()] = s
+	}
+
+	return g
+}
+
+// QNames returns the sorted qualified names of the graph nodes
+func (g *ObjectGraph) QNames() []string {
+	s := make([]string, 0, len(g.Nodes))
+	for qn := range g.Nodes {
+		s = append(s, qn)
+	}
+
+	sort.Strings(s)
+
+	return s
+}
+
+// IsExternal reports whether the node is a reference to an object not in the set
+func (g *ObjectGraph) IsExternal(qn string) bool {
+	objInfo, ok := g.Nodes[qn]
+	return ok && objInfo == nil
+}
+
+// Dependents returns the reversed edges of the graph
+func (g *ObjectGraph) Dependents() map[string][]string {
+	r := make(map[string][]string)
+
+	for _, qn := range g.QNames() {
+		for _, d := range g.Edges[qn] {
+			r[d] = append(r[d], qn)
+		}
+	}
+
+	return r
+}
+
+// Reachable returns the nodes reachable from the given nodes
+// following the dependencies or, if reverse is set, the dependents
+func (g *ObjectGraph) Reachable(qns []string, reverse bool) map[string]bool {
+	edges := g.Edges
+	if reverse {
+		edges = g.Dependents()
+	}
+
+	m := make(map[string]bool)
+
+	var visitFn func(qn string)
+	visitFn = func(qn string) {
+		if m[qn] {
+			return
+		}
+
+		m[qn] = true
+
+		for _, d := range edges[qn] {
+			visitFn(d)
+		}
+	}
+
+	for _, qn := range qns {
+		if _, ok := g.Nodes[qn]; ok {
+			visitFn(qn)
+		}
+	}
+
+	return m
+}
+
+// Subgraph returns the graph restricted to the given nodes
+func (g *ObjectGraph) Subgraph(qns map[string]bool) *ObjectGraph {
+	sg := &ObjectGraph{
+		Nodes: make(map[string]*ObjectInfo),
+		Edges: make(map[string][]string),
+	}
+
+	for qn, objInfo := range g.Nodes {
+		if !qns[qn] {
+			continue
+		}
+
+		sg.Nodes[qn] = objInfo
+
+		if edges, ok := g.Edges[qn]; ok {
+			s := make([]string, 0, len(edges))
+			for _, d := range edges {
+				if qns[d] {
+					s = append(s, d)
+				}
+			}
+
+			sg.Edges[qn] = s
+		}
+	}
+
+	return sg
+}
+
+// CycleError reports a dependency cycle
+type CycleError struct {
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle: %s -> %s", strings.Join(e.Cycle, " -> "), e.Cycle[0])
+}
+
+// Levels groups the objects by dependency level, the objects of a level depend only
+// on objects of the previous levels, a CycleError is returned if the graph has cycles
+func (g *ObjectGraph) Levels() ([]ObjectInfoSlice, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	level := make(map[string]int)
+	var stack []string
+
+	var visitFn func(qn string) error
+	visitFn = func(qn string) error {
+		switch state[qn] {
+		case visited:
+			return nil
+		case visiting:
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] == qn {
+					return &CycleError{Cycle: append([]string(nil), stack[i:]...)}
+				}
+			}
+		}
+
+		state[qn] = visiting
+		stack = append(stack, qn)
+
+		l := 0
+		for _, d := range g.Edges[qn] {
+			if g.IsExternal(d) {
+				continue
+			}
+
+			if err := visitFn(d); err != nil {
+				return err
+			}
+
+			if l < level[d]+1 {
+				l = level[d] + 1
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[qn] = visited
+		level[qn] = l
+
+		return nil
+	}
+
+	var levels []ObjectInfoSlice
+
+	for _, qn := range g.QNames() {
+		if g.IsExternal(qn) {
+			continue
+		}
+
+		if err := visitFn(qn); err != nil {
+			return nil, err
+		}
+
+		for len(levels) <= level[qn] {
+			levels = append(levels, ObjectInfoSlice{})
+		}
+
+		levels[level[qn]] = append(levels[level[qn]], g.Nodes[qn])
+	}
+
+	return levels, nil
+}
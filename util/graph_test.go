@@ -0,0 +1,92 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testObject(cls, name string, depend ...string) *ObjectInfo {
+	obj := GenericMap{"name": name}
+
+	for i, qn := range depend {
+		obj[fmt.Sprintf("Ref%d", i)] = GenericMap{
+			"value": qn[len(cls)+1:],
+			"href":  fmt.Sprintf("/mgmt/config/{domain}/%s", qn),
+		}
+	}
+
+	return &ObjectInfo{
+		Name:  name,
+		Class: cls,
+		data:  obj,
+	}
+}
+
+func TestObjectGraphLevels(t *testing.T) {
+	objects := ObjectInfoSlice{
+		testObject("A", "gw", "A/sp", "A/fsh"),
+		testObject("A", "sp", "A/xm"),
+		testObject("A", "xm", "A/default"),
+		testObject("A", "fsh"),
+	}
+
+	levels, err := NewObjectGraph(objects).Levels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var qns [][]string
+	for _, level := range levels {
+		var s []string
+		for _, objInfo := range level {
+			s = append(s, objInfo.QName())
+		}
+		qns = append(qns, s)
+	}
+
+	expected := [][]string{
+		{"A/fsh", "A/xm"},
+		{"A/sp"},
+		{"A/gw"},
+	}
+
+	if !reflect.DeepEqual(qns, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, qns)
+	}
+}
+
+func TestObjectGraphCycle(t *testing.T) {
+	objects := ObjectInfoSlice{
+		testObject("A", "a", "A/b"),
+		testObject("A", "b", "A/c"),
+		testObject("A", "c", "A/a"),
+		testObject("A", "d", "A/a"),
+	}
+
+	_, err := NewObjectGraph(objects).Levels()
+
+	cycleErr, ok := err.(*CycleError)
+	if !ok {
+		t.Fatalf("Expected a cycle error, got '%v'", err)
+	}
+
+	expected := "dependency cycle: A/a -> A/b -> A/c -> A/a"
+	if cycleErr.Error() != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, cycleErr.Error())
+	}
+}
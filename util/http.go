@@ -16,6 +16,7 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
@@ -30,6 +31,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/lfeier/dpctl/log"
@@ -68,40 +70,91 @@ func AbsoluteMgmtURL(rootMgmtURL, mgmtURL string, a ...interface{}) (string, err
 	return u.String(), nil
 }
 
-// DoHTTPRequest sends an HTTP request to DataPower returning the parsed JSON response
-func DoHTTPRequest(httpClient *http.Client, method, url, userName, userPassword string, rqBody interface{}) (interface{}, error) {
-	var r io.Reader
+// Do sends an HTTP request to DataPower returning the parsed JSON response,
+// the idempotent requests are retried according to the client retry policy
+func (c *Client) Do(ctx context.Context, method, url string, rqBody interface{}) (interface{}, error) {
+	var b []byte
 	if rqBody != nil {
-		b, err := json.Marshal(rqBody)
+		var err error
+		b, err = json.Marshal(rqBody)
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	// fail early on malformed requests, they are not retried
+	if _, err := http.NewRequest(method, url, nil); err != nil {
+		return nil, err
+	}
+
+	policy := c.RetryPolicy
+	throttle := c.Throttle
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if throttle != nil {
+			if err := throttle.acquire(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		start := time.Now()
+		rsBody, statusCode, err := c.do(ctx, method, url, b)
+
+		if throttle != nil {
+			throttle.release(time.Since(start), ctx.Err() == nil && (statusCode == 0 || statusCode >= 500))
+		}
+
+		if err == nil || ctx.Err() != nil || attempt >= policy.MaxAttempts || !policy.retryable(method, statusCode, rsBody) {
+			return rsBody, err
+		}
+
+		d := policy.backoff(attempt)
+		atomic.AddUint64(c.retries, 1)
+
+		log.DbgLogger2.Printf("retry %d of %d in %v: %s %s: %s", attempt, policy.MaxAttempts-1, d.Truncate(time.Millisecond), method, url, err.Error())
+
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// do sends an HTTP request returning the parsed JSON response and the
+// HTTP status code, the status code is 0 if no response was received
+func (c *Client) do(ctx context.Context, method, url string, b []byte) (interface{}, int, error) {
+	var r io.Reader
+	if b != nil {
 		r = bytes.NewReader(b)
 	}
 
-	req, err := http.NewRequest(method, url, r)
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	req.SetBasicAuth(userName, userPassword)
+	req.SetBasicAuth(c.UserName, c.Password)
 
-	if log.DebugLevel >= 5 {
+	if c.Dump {
 		dump, _ := httputil.DumpRequestOut(req, true)
 		log.DbgLogger5.Printf("HTTP Request:\n%v", string(dump))
 	}
 
-	res, err := httpClient.Do(req)
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	if log.DebugLevel >= 5 {
+	if c.Dump {
 		dump, _ := httputil.DumpResponse(res, true)
 		log.DbgLogger5.Printf("HTTP Response:\n%v", string(dump))
 	}
 
-	if err != nil {
-		return nil, err
-	}
-
 	defer func() {
 		if err := res.Body.Close(); err != nil {
 			panic(err.Error())
@@ -111,29 +164,35 @@ func DoHTTPRequest(httpClient *http.Client, method, url, userName, userPassword
 	body, err := ioutil.ReadAll(res.Body)
 
 	if err != nil {
-		return nil, err
+		return nil, res.StatusCode, err
 	}
 
 	var rsBody interface{}
-	if err := json.Unmarshal(body, &rsBody); err != nil {
-		return nil, err
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &rsBody); err != nil {
+			if res.StatusCode >= 300 {
+				return nil, res.StatusCode, newHTTPError(res, nil, body)
+			}
+
+			return nil, res.StatusCode, fmt.Errorf("invalid JSON response: %s %s: %s", method, url, readableBody(body))
+		}
 	}
 
 	if res.StatusCode >= 300 {
-		return rsBody, fmt.Errorf("HTTP response error: %s", res.Status)
+		return rsBody, res.StatusCode, newHTTPError(res, rsBody, body)
 	}
 
-	return rsBody, nil
+	return rsBody, res.StatusCode, nil
 }
 
 // GetObjectClasses returns all object classes
-func GetObjectClasses(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword string) ([]string, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/config/")
+func (c *Client) GetObjectClasses(ctx context.Context) ([]string, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/config/")
 	if err != nil {
 		return nil, err
 	}
 
-	rsBody, err := DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	rsBody, err := c.Do(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -152,13 +211,13 @@ func GetObjectClasses(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUser
 }
 
 // GetObject returns a domain object of a given class and name
-func GetObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, class, name string) (interface{}, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/config/%s/%s/%s", domain, class, name)
+func (c *Client) GetObject(ctx context.Context, class, name string) (interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/config/%s/%s/%s", c.DomainName, class, name)
 	if err != nil {
 		return nil, err
 	}
 
-	rsBody, err := DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	rsBody, err := c.Do(ctx, "GET", u, nil)
 	if err != nil {
 		return rsBody, err
 	}
@@ -166,14 +225,33 @@ func GetObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPasswor
 	return JSONValue(rsBody, class), nil
 }
 
+// IsObject checks if a domain object of a given class and name exist
+func (c *Client) IsObject(ctx context.Context, class, name string) (bool, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/config/%s/%s/%s", c.DomainName, class, name)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.Do(ctx, "GET", u, nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
 // GetSingletonObject returns a singleton domain object of a given class
-func GetSingletonObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, class string) (interface{}, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/config/%s/%s", domain, class)
+func (c *Client) GetSingletonObject(ctx context.Context, class string) (interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/config/%s/%s", c.DomainName, class)
 	if err != nil {
 		return nil, err
 	}
 
-	rsBody, err := DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	rsBody, err := c.Do(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -187,13 +265,13 @@ func GetSingletonObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUs
 }
 
 // GetObjects returns all domain objects of a given class
-func GetObjects(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, class string) ([]interface{}, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/config/%s/%s", domain, class)
+func (c *Client) GetObjects(ctx context.Context, class string) ([]interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/config/%s/%s", c.DomainName, class)
 	if err != nil {
 		return nil, err
 	}
 
-	rsBody, err := DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	rsBody, err := c.Do(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -216,13 +294,13 @@ func GetObjects(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPasswo
 }
 
 // GetFileStores returns all file stores
-func GetFileStores(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain string) ([]string, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/filestore/%s", domain)
+func (c *Client) GetFileStores(ctx context.Context) ([]string, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/filestore/%s", c.DomainName)
 	if err != nil {
 		return nil, err
 	}
 
-	rsBody, err := DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	rsBody, err := c.Do(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -238,13 +316,13 @@ func GetFileStores(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPas
 }
 
 // GetFile retrieves a file from the file store
-func GetFile(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, path string) ([]byte, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/filestore/%s/%s", domain, path)
+func (c *Client) GetFile(ctx context.Context, path string) ([]byte, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/filestore/%s/%s", c.DomainName, path)
 	if err != nil {
 		return nil, err
 	}
 
-	rsBody, err := DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	rsBody, err := c.Do(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -254,8 +332,8 @@ func GetFile(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword,
 }
 
 // CreateOrUpdateObject creates a configuration object or updates it if already exist
-func CreateOrUpdateObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, cls string, obj interface{}) (interface{}, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/config/%s/%s/%s", domain, cls, JSONValue(obj, "name").(string))
+func (c *Client) CreateOrUpdateObject(ctx context.Context, cls string, obj interface{}) (interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/config/%s/%s/%s", c.DomainName, cls, JSONValue(obj, "name").(string))
 	if err != nil {
 		return nil, err
 	}
@@ -263,7 +341,7 @@ func CreateOrUpdateObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dp
 	m := make(map[string]interface{})
 	m[cls] = obj
 
-	rsBody, err := DoHTTPRequest(httpClient, "PUT", u, dpUserName, dpUserPassword, m)
+	rsBody, err := c.Do(ctx, "PUT", u, m)
 	if err != nil {
 		return rsBody, err
 	}
@@ -272,27 +350,27 @@ func CreateOrUpdateObject(httpClient *http.Client, dpRestMgmtURL, dpUserName, dp
 }
 
 // IsDirectory checks if a directory exist
-func IsDirectory(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, path string) (bool, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/filestore/%s/%s", domain, path)
+func (c *Client) IsDirectory(ctx context.Context, path string) (bool, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/filestore/%s/%s", c.DomainName, path)
 	if err != nil {
 		return false, err
 	}
 
-	_, err = DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	_, err = c.Do(ctx, "GET", u, nil)
 	if err != nil {
-		if strings.Contains(err.Error(), "404 Not Found") {
+		if IsNotFound(err) {
 			return false, nil
-		} else {
-			return false, err
 		}
+
+		return false, err
 	}
 
 	return true, nil
 }
 
 // CreateDirectories recursively creates directories
-func CreateDirectories(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, path string) error {
-	ok, err := IsDirectory(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, path)
+func (c *Client) CreateDirectories(ctx context.Context, path string) error {
+	ok, err := c.IsDirectory(ctx, path)
 	if err != nil {
 		return err
 	}
@@ -300,11 +378,11 @@ func CreateDirectories(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUse
 		return nil
 	}
 
-	if err := CreateDirectories(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, filepath.Dir(path)); err != nil {
+	if err := c.CreateDirectories(ctx, filepath.Dir(path)); err != nil {
 		return err
 	}
 
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/filestore/%s/%s", domain, path)
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/filestore/%s/%s", c.DomainName, path)
 	if err != nil {
 		return err
 	}
@@ -314,21 +392,45 @@ func CreateDirectories(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUse
 	m["directory"] = d
 	d["name"] = filepath.Base(path)
 
-	_, err = DoHTTPRequest(httpClient, "PUT", u, dpUserName, dpUserPassword, m)
-	if err != nil && !strings.Contains(err.Error(), "409 Conflict") {
+	_, err = c.Do(ctx, "PUT", u, m)
+	if err != nil && !IsConflict(err) {
 		return err
 	}
 
 	return nil
 }
 
+// DeleteObject deletes a configuration object
+func (c *Client) DeleteObject(ctx context.Context, class, name string) error {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/config/%s/%s/%s", c.DomainName, class, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(ctx, "DELETE", u, nil)
+
+	return err
+}
+
+// DeleteFile deletes a file
+func (c *Client) DeleteFile(ctx context.Context, path string) error {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/filestore/%s/%s", c.DomainName, path)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(ctx, "DELETE", u, nil)
+
+	return err
+}
+
 // CreateOrUpdateFile creates or updates a file with the given data
-func CreateOrUpdateFile(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, path string, data []byte) (interface{}, error) {
-	if err := CreateDirectories(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, filepath.Dir(path)); err != nil {
+func (c *Client) CreateOrUpdateFile(ctx context.Context, path string, data []byte) (interface{}, error) {
+	if err := c.CreateDirectories(ctx, filepath.Dir(path)); err != nil {
 		return nil, err
 	}
 
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/filestore/%s/%s", domain, path)
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/filestore/%s/%s", c.DomainName, path)
 	if err != nil {
 		return nil, err
 	}
@@ -339,7 +441,7 @@ func CreateOrUpdateFile(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUs
 	f["name"] = filepath.Base(path)
 	f["content"] = base64.StdEncoding.EncodeToString(data)
 
-	rsBody, err := DoHTTPRequest(httpClient, "PUT", u, dpUserName, dpUserPassword, m)
+	rsBody, err := c.Do(ctx, "PUT", u, m)
 	if err != nil {
 		return rsBody, err
 	}
@@ -357,7 +459,7 @@ type WalkFileFunc func(path string, modified string, size uint) error
 var ErrSkipDir = errors.New("skip directory")
 
 // WalkFileStore walks file store rooted at path
-func WalkFileStore(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, path string, walkDirFn WalkDirFunc, walkFileFn WalkFileFunc) error {
+func (c *Client) WalkFileStore(ctx context.Context, path string, walkDirFn WalkDirFunc, walkFileFn WalkFileFunc) error {
 	if err := walkDirFn(path); err != nil {
 		if err == ErrSkipDir {
 			return nil
@@ -368,7 +470,7 @@ func WalkFileStore(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPas
 
 	var fn func(string) error
 	fn = func(p string) error {
-		d, f, err := lsFileStore(httpClient, dpRestMgmtURL, dpUserName, dpUserPassword, domain, p)
+		d, f, err := c.lsFileStore(ctx, p)
 		if err != nil {
 			return err
 		}
@@ -390,7 +492,7 @@ func WalkFileStore(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPas
 
 			if err = walkDirFn(fmt.Sprintf("%s/%s", p, n)); err != nil {
 				if err == ErrSkipDir {
-					return nil
+					continue
 				} else {
 					return err
 				}
@@ -408,13 +510,13 @@ func WalkFileStore(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPas
 }
 
 // lsFileStore lists directories and files at a given path
-func lsFileStore(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, path string) (d []interface{}, f []interface{}, e error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/filestore/%s/%s", domain, path)
+func (c *Client) lsFileStore(ctx context.Context, path string) (d []interface{}, f []interface{}, e error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/filestore/%s/%s", c.DomainName, path)
 	if err != nil {
 		return d, f, err
 	}
 
-	rsBody, err := DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	rsBody, err := c.Do(ctx, "GET", u, nil)
 	if err != nil {
 		return d, f, err
 	}
@@ -441,16 +543,113 @@ func lsFileStore(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassw
 }
 
 // GetStatus returns the status information from a given provider
-func GetStatus(httpClient *http.Client, dpRestMgmtURL, dpUserName, dpUserPassword, domain, statusProvider string) (interface{}, error) {
-	u, err := AbsoluteMgmtURL(dpRestMgmtURL, "/mgmt/status/%s/%s", domain, statusProvider)
+func (c *Client) GetStatus(ctx context.Context, statusProvider string) (interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/status/%s/%s", c.DomainName, statusProvider)
 	if err != nil {
 		return nil, err
 	}
 
-	rsBody, err := DoHTTPRequest(httpClient, "GET", u, dpUserName, dpUserPassword, nil)
+	rsBody, err := c.Do(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	return rsBody, nil
 }
+
+// GetObjectOpState returns the operational state of a domain object of a given class and name,
+// an empty string is returned if the object status is not available yet
+func (c *Client) GetObjectOpState(ctx context.Context, class, name string) (string, error) {
+	rsBody, err := c.GetStatus(ctx, "ObjectStatus")
+	if err != nil {
+		return "", err
+	}
+
+	var s []interface{}
+
+	l := JSONValue(rsBody, "ObjectStatus")
+
+	switch reflect.ValueOf(l).Kind() {
+	case reflect.Map:
+		s = append(s, l)
+	case reflect.Slice:
+		s = append(s, l.([]interface{})...)
+	}
+
+	for _, o := range s {
+		if JSONValue(o, "Class") == class && JSONValue(o, "Name") == name {
+			if opState, ok := JSONValue(o, "OpState").(string); ok {
+				return opState, nil
+			}
+
+			break
+		}
+	}
+
+	return "", nil
+}
+
+// GetFirmwareVersion returns the firmware version
+func (c *Client) GetFirmwareVersion(ctx context.Context) (string, error) {
+	for _, statusProvider := range []string{"FirmwareVersion3", "FirmwareVersion"} {
+		rsBody, err := c.InDomain("default").GetStatus(ctx, statusProvider)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+
+			return "", err
+		}
+
+		if v, ok := JSONValue(rsBody, statusProvider, "Version").(string); ok {
+			return v, nil
+		}
+	}
+
+	return "", errors.New("firmware version not available")
+}
+
+// GetClassMetadata returns the metadata of a configuration class
+func (c *Client) GetClassMetadata(ctx context.Context, class string) (interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/metadata/%s/%s", c.DomainName, class)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(ctx, "GET", u, nil)
+}
+
+// GetTypeMetadata returns the metadata of a property type referenced by href
+func (c *Client) GetTypeMetadata(ctx context.Context, href string) (interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "%s", href)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(ctx, "GET", u, nil)
+}
+
+// ExecuteAction posts an action to the domain action queue, the response of an
+// asynchronous action links to its status location
+func (c *Client) ExecuteAction(ctx context.Context, name string, params interface{}) (interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "/mgmt/actionqueue/%s", c.DomainName)
+	if err != nil {
+		return nil, err
+	}
+
+	if params == nil {
+		params = GenericMap{}
+	}
+
+	return c.Do(ctx, "POST", u, GenericMap{name: params})
+}
+
+// GetActionStatus returns the status of an asynchronous action from its status location
+func (c *Client) GetActionStatus(ctx context.Context, href string) (interface{}, error) {
+	u, err := AbsoluteMgmtURL(c.URL, "%s", href)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(ctx, "GET", u, nil)
+}
@@ -62,10 +62,9 @@ func ReadDataFromFile(file string) (interface{}, error) {
 	return data, nil
 }
 
-// WriteDataToFile writes the data to a file in JSON format
+// WriteDataToFile writes the data to a file in canonical JSON format
 func WriteDataToFile(data interface{}, file string) error {
-	b, err := json.MarshalIndent(data, "", "  ")
-
+	b, err := FormatJSON(data, DefaultIndent)
 	if err != nil {
 		return err
 	}
@@ -46,3 +46,15 @@ func JSONValue(jsonData interface{}, p ...interface{}) interface{} {
 
 	return c
 }
+
+// JSONArray returns the value as an array, a single value is wrapped in an array
+func JSONArray(v interface{}) GenericArray {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case GenericArray:
+		return t
+	default:
+		return GenericArray{t}
+	}
+}
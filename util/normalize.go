@@ -0,0 +1,119 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Normalizer removes from configuration objects the properties carrying no
+// configuration: the properties with the class default value, the read-only
+// properties and the ignored properties. Pushing a normalized object restores
+// the same configuration as DataPower applies the defaults
+type Normalizer struct {
+	Schema *SchemaRepository
+	// Ignore matches the properties always removed by path, class/property or
+	// class/property/subproperty for the complex properties, nil to ignore none
+	Ignore *regexp.Regexp
+}
+
+// Normalize removes the properties of an object in place, the objects of unknown
+// classes are not changed
+func (n *Normalizer) Normalize(class string, obj GenericMap) error {
+	c, err := n.Schema.Class(class)
+	if err != nil {
+		return err
+	}
+
+	if c == nil {
+		return nil
+	}
+
+	for k, v := range obj {
+		if k == "name" {
+			continue
+		}
+
+		if n.normalizeProperty(class, c.Properties[k], k, v) {
+			delete(obj, k)
+		}
+	}
+
+	return nil
+}
+
+// normalizeProperty normalizes a property value and reports whether the property
+// has to be removed, the unknown properties are kept
+func (n *Normalizer) normalizeProperty(prefix string, p *PropertySchema, name string, v interface{}) bool {
+	path := fmt.Sprintf("%s/%s", prefix, name)
+
+	if n.Ignore != nil && n.Ignore.MatchString(path) {
+		return true
+	}
+
+	if p == nil {
+		return false
+	}
+
+	if p.ReadOnly {
+		return true
+	}
+
+	if p.Type != nil && p.Type.Properties != nil {
+		switch t := v.(type) {
+		case GenericMap:
+			n.normalizeComplex(path, p.Type.Properties, t)
+			return len(t) == 0
+		case []interface{}:
+			for _, e := range t {
+				if m, ok := e.(GenericMap); ok {
+					n.normalizeComplex(path, p.Type.Properties, m)
+				}
+			}
+		}
+
+		return false
+	}
+
+	return !p.Required && !p.Vector && isDefaultValue(v, p.Default)
+}
+
+func (n *Normalizer) normalizeComplex(path string, props map[string]*PropertySchema, m GenericMap) {
+	for k, v := range m {
+		if n.normalizeProperty(path, props[k], k, v) {
+			delete(m, k)
+		}
+	}
+}
+
+// isDefaultValue reports whether a scalar or a reference value is the default value,
+// DataPower returns the numbers either as JSON numbers or as strings
+func isDefaultValue(v interface{}, def interface{}) bool {
+	if def == nil {
+		return false
+	}
+
+	if m, ok := v.(GenericMap); ok {
+		v = m["value"]
+	}
+
+	switch v.(type) {
+	case string, float64, bool:
+		return fmt.Sprint(v) == fmt.Sprint(def)
+	}
+
+	return false
+}
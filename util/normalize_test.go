@@ -0,0 +1,97 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	c := &ClassSchema{
+		Name: "XMLManager",
+		Properties: map[string]*PropertySchema{
+			"mAdminState": {Name: "mAdminState", Default: "enabled"},
+			"CacheSize":   {Name: "CacheSize", Default: "256"},
+			"Required":    {Name: "Required", Default: "on", Required: true},
+			"UserAgent":   {Name: "UserAgent", RefClass: "HTTPUserAgent", Default: "default"},
+			"Status":      {Name: "Status", ReadOnly: true},
+			"Firmware":    {Name: "Firmware"},
+			"Rules": {
+				Name:   "Rules",
+				Vector: true,
+				Type: &TypeSchema{Name: "dmRule", Base: "complex", Properties: map[string]*PropertySchema{
+					"Match": {Name: "Match"},
+					"Type":  {Name: "Type", Default: "all"},
+				}},
+			},
+			"Settings": {
+				Name: "Settings",
+				Type: &TypeSchema{Name: "dmSettings", Base: "complex", Properties: map[string]*PropertySchema{
+					"Timeout": {Name: "Timeout", Default: "60"},
+				}},
+			},
+		},
+	}
+
+	n := &Normalizer{
+		Schema: &SchemaRepository{classes: map[string]*ClassSchema{"XMLManager": c}},
+		Ignore: regexp.MustCompile("^XMLManager/Firmware$"),
+	}
+
+	var obj GenericMap
+	err := json.Unmarshal([]byte(`{
+		"name": "xm",
+		"mAdminState": "enabled",
+		"CacheSize": 256,
+		"Required": "on",
+		"UserAgent": {"value": "default", "href": "/mgmt/config/{domain}/HTTPUserAgent/default"},
+		"Status": "up",
+		"Firmware": "2018.4",
+		"Rules": [{"Match": "*", "Type": "all"}, {"Match": "a", "Type": "any"}],
+		"Settings": {"Timeout": "60"},
+		"Unknown": "u"
+	}`), &obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Normalize("XMLManager", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected GenericMap
+	err = json.Unmarshal([]byte(`{
+		"name": "xm",
+		"Required": "on",
+		"Rules": [{"Match": "*"}, {"Match": "a", "Type": "any"}],
+		"Unknown": "u"
+	}`), &expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, obj)
+	}
+
+	unknown := GenericMap{"name": "x", "CacheSize": "256"}
+	n.Schema.classes["Unknown"] = nil
+	if err := n.Normalize("Unknown", unknown); err != nil || len(unknown) != 2 {
+		t.Errorf("Expected the object of an unknown class unchanged, got '%v' (%v)", unknown, err)
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchExt is the extension of the object patch files
+const PatchExt = ".patch.json"
+
+// ApplyPatch applies a patch to a JSON document, a JSON object is an
+// RFC 7386 merge patch and a JSON array is an RFC 6902 JSON patch
+func ApplyPatch(doc interface{}, patch interface{}) (interface{}, error) {
+	switch p := patch.(type) {
+	case GenericMap:
+		return MergePatch(doc, p), nil
+	case []interface{}:
+		return JSONPatch(doc, p)
+	default:
+		return nil, errors.New("patch must be a JSON object (merge patch) or a JSON array (JSON patch)")
+	}
+}
+
+// MergePatch applies an RFC 7386 merge patch to a JSON document, the document is modified
+func MergePatch(doc interface{}, patch interface{}) interface{} {
+	p, ok := patch.(GenericMap)
+	if !ok {
+		return patch
+	}
+
+	d, ok := doc.(GenericMap)
+	if !ok {
+		d = GenericMap{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+			continue
+		}
+
+		d[k] = MergePatch(d[k], v)
+	}
+
+	return d
+}
+
+// JSONPatch applies an RFC 6902 JSON patch to a JSON document, the document is modified
+func JSONPatch(doc interface{}, ops []interface{}) (interface{}, error) {
+	for i, o := range ops {
+		op, ok := o.(GenericMap)
+		if !ok {
+			return nil, fmt.Errorf("operation %d: JSON object expected", i)
+		}
+
+		var err error
+		doc, err = applyPatchOp(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %v", i, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func applyPatchOp(doc interface{}, op GenericMap) (interface{}, error) {
+	name, _ := op["op"].(string)
+
+	path, ok := op["path"].(string)
+	if !ok {
+		return nil, errors.New("missing 'path'")
+	}
+
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	value, hasValue := op["value"]
+
+	switch name {
+	case "add", "replace", "test":
+		if !hasValue {
+			return nil, fmt.Errorf("missing 'value' for %s", name)
+		}
+	case "move", "copy":
+		from, ok := op["from"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing 'from' for %s", name)
+		}
+
+		fromTokens, err := parsePointer(from)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err = pointerGet(doc, fromTokens)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "move" {
+			doc, err = pointerRemove(doc, fromTokens)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value = copyJSON(value)
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unknown operation: '%s'", name)
+	}
+
+	switch name {
+	case "add", "move", "copy":
+		return pointerAdd(doc, tokens, value)
+	case "remove":
+		return pointerRemove(doc, tokens)
+	case "replace":
+		if _, err := pointerGet(doc, tokens); err != nil {
+			return nil, err
+		}
+
+		if len(tokens) == 0 {
+			return value, nil
+		}
+
+		doc, err = pointerRemove(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		return pointerAdd(doc, tokens, value)
+	default:
+		v, err := pointerGet(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reflect.DeepEqual(v, value) {
+			return nil, fmt.Errorf("test failed: %s", path)
+		}
+
+		return doc, nil
+	}
+}
+
+// parsePointer returns the reference tokens of an RFC 6901 JSON pointer
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer: '%s'", p)
+	}
+
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+func pointerIndex(a []interface{}, t string, allowEnd bool) (int, error) {
+	if allowEnd && t == "-" {
+		return len(a), nil
+	}
+
+	i, err := strconv.Atoi(t)
+	if err != nil || i < 0 || (t != "0" && strings.HasPrefix(t, "0")) {
+		return 0, fmt.Errorf("invalid array index: '%s'", t)
+	}
+
+	max := len(a) - 1
+	if allowEnd {
+		max = len(a)
+	}
+
+	if i > max {
+		return 0, fmt.Errorf("array index out of range: '%s'", t)
+	}
+
+	return i, nil
+}
+
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	v := doc
+	for _, t := range tokens {
+		switch c := v.(type) {
+		case GenericMap:
+			var ok bool
+			if v, ok = c[t]; !ok {
+				return nil, fmt.Errorf("path not found: '%s'", t)
+			}
+		case []interface{}:
+			i, err := pointerIndex(c, t, false)
+			if err != nil {
+				return nil, err
+			}
+
+			v = c[i]
+		default:
+			return nil, fmt.Errorf("path not found: '%s'", t)
+		}
+	}
+
+	return v, nil
+}
+
+// pointerAdd adds the value at the location, the containers are replaced in
+// their parents as adding to an array creates a new slice
+func pointerAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	t := tokens[0]
+
+	switch c := doc.(type) {
+	case GenericMap:
+		if len(tokens) == 1 {
+			c[t] = value
+			return c, nil
+		}
+
+		child, ok := c[t]
+		if !ok {
+			return nil, fmt.Errorf("path not found: '%s'", t)
+		}
+
+		v, err := pointerAdd(child, tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+
+		c[t] = v
+
+		return c, nil
+	case []interface{}:
+		if len(tokens) == 1 {
+			i, err := pointerIndex(c, t, true)
+			if err != nil {
+				return nil, err
+			}
+
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+
+			return c, nil
+		}
+
+		i, err := pointerIndex(c, t, false)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := pointerAdd(c[i], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+
+		c[i] = v
+
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path not found: '%s'", t)
+	}
+}
+
+func pointerRemove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("cannot remove the document root")
+	}
+
+	t := tokens[0]
+
+	switch c := doc.(type) {
+	case GenericMap:
+		child, ok := c[t]
+		if !ok {
+			return nil, fmt.Errorf("path not found: '%s'", t)
+		}
+
+		if len(tokens) == 1 {
+			delete(c, t)
+			return c, nil
+		}
+
+		v, err := pointerRemove(child, tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		c[t] = v
+
+		return c, nil
+	case []interface{}:
+		i, err := pointerIndex(c, t, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tokens) == 1 {
+			return append(c[:i], c[i+1:]...), nil
+		}
+
+		v, err := pointerRemove(c[i], tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		c[i] = v
+
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path not found: '%s'", t)
+	}
+}
+
+// copyJSON returns a deep copy of a JSON value
+func copyJSON(v interface{}) interface{} {
+	switch c := v.(type) {
+	case GenericMap:
+		m := make(GenericMap, len(c))
+		for k, e := range c {
+			m[k] = copyJSON(e)
+		}
+
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(c))
+		for i, e := range c {
+			a[i] = copyJSON(e)
+		}
+
+		return a
+	default:
+		return v
+	}
+}
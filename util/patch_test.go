@@ -0,0 +1,163 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+)
+
+func parseJSON(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, expected string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`{"a": {"b": "c", "d": "e"}}`, `{"a": {"d": null, "f": "g"}}`, `{"a": {"b": "c", "f": "g"}}`},
+		{`["a"]`, `{"a": {"b": null}}`, `{"a": {}}`},
+	}
+
+	for _, test := range tests {
+		v, err := ApplyPatch(parseJSON(t, test.doc), parseJSON(t, test.patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := parseJSON(t, test.expected); !reflect.DeepEqual(v, expected) {
+			t.Errorf("Expected '%v', got '%v'", expected, v)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, expected string
+	}{
+		{`{"a": 1}`, `[{"op": "add", "path": "/b", "value": 2}]`, `{"a": 1, "b": 2}`},
+		{`{"a": [1, 3]}`, `[{"op": "add", "path": "/a/1", "value": 2}]`, `{"a": [1, 2, 3]}`},
+		{`{"a": [1]}`, `[{"op": "add", "path": "/a/-", "value": 2}]`, `{"a": [1, 2]}`},
+		{`{"a": {"b": 1, "c": 2}}`, `[{"op": "remove", "path": "/a/b"}]`, `{"a": {"c": 2}}`},
+		{`{"a": [1, 2, 3]}`, `[{"op": "remove", "path": "/a/0"}]`, `{"a": [2, 3]}`},
+		{`{"a": {"b": 1}}`, `[{"op": "replace", "path": "/a/b", "value": {"c": 2}}]`, `{"a": {"b": {"c": 2}}}`},
+		{`{"a": 1}`, `[{"op": "move", "from": "/a", "path": "/b"}]`, `{"b": 1}`},
+		{`{"a": {"b": 1}}`, `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "replace", "path": "/c/b", "value": 2}]`, `{"a": {"b": 1}, "c": {"b": 2}}`},
+		{`{"a/b": 1, "m~n": 2}`, `[{"op": "test", "path": "/a~1b", "value": 1}, {"op": "remove", "path": "/m~0n"}]`, `{"a/b": 1}`},
+	}
+
+	for _, test := range tests {
+		v, err := ApplyPatch(parseJSON(t, test.doc), parseJSON(t, test.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", test.patch, err)
+		}
+
+		if expected := parseJSON(t, test.expected); !reflect.DeepEqual(v, expected) {
+			t.Errorf("Expected '%v', got '%v'", expected, v)
+		}
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	tests := []string{
+		`[{"op": "replace", "path": "/x", "value": 1}]`,
+		`[{"op": "remove", "path": "/a/5"}]`,
+		`[{"op": "add", "path": "/x/y", "value": 1}]`,
+		`[{"op": "test", "path": "/b", "value": 1}]`,
+		`[{"op": "copy", "path": "/c"}]`,
+		`[{"op": "unknown", "path": "/a"}]`,
+		`[{"op": "add", "path": "a", "value": 1}]`,
+		`"patch"`,
+	}
+
+	for _, test := range tests {
+		if _, err := ApplyPatch(parseJSON(t, `{"a": [1], "b": 2}`), parseJSON(t, test)); err == nil {
+			t.Errorf("Expected an error for '%v'", test)
+		}
+	}
+}
+
+func TestScanProjectObjectsPatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"base/metadata.json":                    `{"priority": 3}`,
+		"base/objects/XMLManager/xm.json":       `{"name": "xm", "CacheSize": 256, "UserAgent": "ua"}`,
+		"base/objects/XMLManager/xm.patch.json": `{"Base": true}`,
+		"env/metadata.json":                     `{"priority": 2}`,
+		"env/objects/XMLManager/xm.patch.json":  `{"CacheSize": 512, "UserAgent": null}`,
+		"env/objects/XMLManager/xm2.patch.json": `{"CacheSize": 1}`,
+		"top/metadata.json":                     `{"priority": 1}`,
+		"top/objects/XMLManager/xm.patch.json":  `[{"op": "replace", "path": "/CacheSize", "value": 1024}]`,
+	}
+
+	fixture.WriteFiles(t, dir, files)
+
+	pkgs, err := ProjectPackages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var problems []string
+	objects, err := ScanProjectObjects(pkgs, func(path string, err error) error {
+		problems = append(problems, err.Error())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedProblems := []string{"patch target object not found: XMLManager/xm2"}
+	if !reflect.DeepEqual(problems, expectedProblems) {
+		t.Errorf("Expected '%v', got '%v'", expectedProblems, problems)
+	}
+
+	if len(objects) != 1 {
+		t.Fatalf("Expected '%v' objects, got '%v'", 1, len(objects))
+	}
+
+	obj, err := objects[0].Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the patch of the base package applies too, the packages are applied from base to top
+	expected := parseJSON(t, `{"name": "xm", "CacheSize": 1024, "Base": true}`)
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, obj)
+	}
+
+	if _, err := GetProjectObjects(pkgs); err == nil {
+		t.Errorf("Expected an error for the patch without object")
+	}
+}
@@ -16,6 +16,7 @@ package util
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -31,8 +32,20 @@ import (
 type Package struct {
 	Name     string
 	Dir      string
-	Tags     []string `json:"tags"`
-	Priority uint     `json:"priority"`
+	Tags     []string   `json:"tags"`
+	Priority uint       `json:"priority"`
+	Domain   GenericMap `json:"domain"`
+	// Requires are the names of the packages selected with the package
+	Requires []string `json:"requires"`
+	// Imports are the packages from outside the project directory, paths
+	// relative to the package directory or names in the package cache
+	Imports []string `json:"imports"`
+	// Routes decide which package receives the items pulled for the first time
+	Routes *PackageRoutes `json:"routes"`
+	// Format declares how the object files are formatted
+	Format *FormatOptions `json:"format"`
+	// External is set for the imported packages
+	External bool `json:"-"`
 }
 
 // PackageSlice attaches the methods of the sort Interface to []Package, sorting in decreasing priority order
@@ -76,8 +89,30 @@ func (p *Package) HasTag(tag string) bool {
 	return false
 }
 
-// ProjectPackages retuns all project packages sorted by priority
+// ProjectPackages retuns all project packages and their imported packages sorted by
+// priority, the imports by name are resolved in the default package cache
 func ProjectPackages(projectDir string) (PackageSlice, error) {
+	return LoadPackages(projectDir, DefaultPackageCacheDir())
+}
+
+// DefaultPackageCacheDir returns the directory of the shared packages imported by name,
+// $DPCTL_PACKAGE_CACHE or the dpctl/packages user cache directory
+func DefaultPackageCacheDir() string {
+	if d := os.Getenv("DPCTL_PACKAGE_CACHE"); d != "" {
+		return d
+	}
+
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(d, "dpctl", "packages")
+}
+
+// LoadPackages returns all project packages and their imported packages sorted by
+// priority, the imports are resolved transitively and the requires are checked
+func LoadPackages(projectDir string, cacheDir string) (PackageSlice, error) {
 	var pkgs PackageSlice
 
 	p, err := filepath.Abs(projectDir)
@@ -99,6 +134,8 @@ func ProjectPackages(projectDir string) (PackageSlice, error) {
 		return nil, err
 	}
 
+	loaded := make(map[string]bool)
+
 	for _, f := range a {
 		fs, err := os.Stat(f)
 		if err != nil {
@@ -109,21 +146,42 @@ func ProjectPackages(projectDir string) (PackageSlice, error) {
 			continue
 		}
 
-		j, err := ioutil.ReadFile(f)
+		pkg, err := readPackage(filepath.Dir(f))
 		if err != nil {
 			return nil, err
 		}
 
-		pkg := &Package{
-			Name: filepath.Base(filepath.Dir(f)),
-			Dir:  filepath.Dir(f),
-		}
+		pkgs = append(pkgs, pkg)
+		loaded[pkg.Dir] = true
+	}
 
-		if err := json.Unmarshal(j, &pkg); err != nil {
-			return nil, err
+	// the imported packages are appended while iterating to resolve their imports too
+	for i := 0; i < len(pkgs); i++ {
+		for _, imp := range pkgs[i].Imports {
+			dir, err := resolveImport(pkgs[i], imp, cacheDir)
+			if err != nil {
+				return nil, err
+			}
+
+			if loaded[dir] {
+				continue
+			}
+
+			pkg, err := readPackage(dir)
+			if err != nil {
+				return nil, fmt.Errorf("package %s imports %s: %v", pkgs[i].Name, imp, err)
+			}
+
+			log.DbgLogger2.Printf("package imported: %s [%s] from %s", pkg.Name, pkgs[i].Name, pkg.Dir)
+
+			pkg.External = true
+			pkgs = append(pkgs, pkg)
+			loaded[pkg.Dir] = true
 		}
+	}
 
-		pkgs = append(pkgs, pkg)
+	if err := checkRequires(pkgs); err != nil {
+		return nil, err
 	}
 
 	pkgs.Sort()
@@ -131,31 +189,200 @@ func ProjectPackages(projectDir string) (PackageSlice, error) {
 	return pkgs, nil
 }
 
-// FilterPackages returns all packages matching the tags sorted by priority
-func FilterPackages(pkgs PackageSlice, tags []string) PackageSlice {
-	var s PackageSlice
+// readPackage reads the metadata of the package stored in dir
+func readPackage(dir string) (*Package, error) {
+	f := filepath.Join(dir, "metadata.json")
+
+	j, err := ioutil.ReadFile(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("package not found: %s", dir)
+		}
+
+		return nil, err
+	}
+
+	pkg := &Package{
+		Name: filepath.Base(dir),
+		Dir:  dir,
+	}
 
+	if err := json.Unmarshal(j, &pkg); err != nil {
+		return nil, err
+	}
+
+	if pkg.Routes != nil {
+		if err := pkg.Routes.compile(); err != nil {
+			return nil, fmt.Errorf("package %s: %s", pkg.Name, err.Error())
+		}
+	}
+
+	if pkg.Format != nil {
+		if err := pkg.Format.check(); err != nil {
+			return nil, fmt.Errorf("package %s: %s", pkg.Name, err.Error())
+		}
+	}
+
+	return pkg, nil
+}
+
+// resolveImport returns the directory of an imported package, an import is either
+// a path, absolute or relative to the importing package, or a package cache name
+func resolveImport(pkg *Package, imp string, cacheDir string) (string, error) {
+	var dir string
+
+	switch {
+	case filepath.IsAbs(imp):
+		dir = imp
+	case strings.HasPrefix(imp, ".") || strings.ContainsAny(imp, `/\`):
+		dir = filepath.Join(pkg.Dir, filepath.FromSlash(imp))
+	case cacheDir == "":
+		return "", fmt.Errorf("package %s imports %s: package cache not available", pkg.Name, imp)
+	default:
+		dir = filepath.Join(cacheDir, imp)
+	}
+
+	return filepath.Abs(dir)
+}
+
+// checkRequires fails for the required packages not found and the dependency cycles
+func checkRequires(pkgs PackageSlice) error {
+	byName := make(map[string]*Package)
 	for _, pkg := range pkgs {
-		for _, t := range tags {
-			if !pkg.HasTag(t) {
-				goto Next
+		if p, ok := byName[pkg.Name]; ok {
+			return fmt.Errorf("duplicate package name: %s (%s, %s)", pkg.Name, p.Dir, pkg.Dir)
+		}
+
+		byName[pkg.Name] = pkg
+	}
+
+	for _, pkg := range pkgs {
+		for _, r := range pkg.Requires {
+			if _, ok := byName[r]; !ok {
+				return fmt.Errorf("package %s requires unknown package %s", pkg.Name, r)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			i := 0
+			for path[i] != name {
+				i++
 			}
+
+			return fmt.Errorf("package dependency cycle: %s", strings.Join(append(path[i:], name), " -> "))
+		case visited:
+			return nil
 		}
 
-		s = append(s, pkg)
-	Next:
+		state[name] = visiting
+		path = append(path, name)
+
+		for _, r := range byName[name].Requires {
+			if err := visit(r); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
 	}
 
-	s.Sort()
+	for _, pkg := range pkgs {
+		if err := visit(pkg.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FilterPackages returns all packages matching the tags and the packages they require,
+// transitively, sorted by priority
+func FilterPackages(pkgs PackageSlice, tags []string) PackageSlice {
+	s, _ := SelectPackages(pkgs, &PackageSelector{Tags: tags})
 
 	return s
 }
 
+// requiredPackages adds to the selected packages the packages they require
+func requiredPackages(pkgs PackageSlice, selected PackageSlice) PackageSlice {
+	byName := make(map[string]*Package)
+	for _, pkg := range pkgs {
+		byName[pkg.Name] = pkg
+	}
+
+	in := make(map[string]bool)
+	for _, pkg := range selected {
+		in[pkg.Name] = true
+	}
+
+	for i := 0; i < len(selected); i++ {
+		for _, r := range selected[i].Requires {
+			pkg, ok := byName[r]
+			if !ok || in[r] {
+				continue
+			}
+
+			log.DbgLogger2.Printf("package required: %s [%s]", r, selected[i].Name)
+
+			selected = append(selected, pkg)
+			in[r] = true
+		}
+	}
+
+	return selected
+}
+
+// DomainSettings returns the application domain settings declared by the packages,
+// the settings of a package override the settings of the lower priority packages
+func DomainSettings(pkgs PackageSlice) GenericMap {
+	pkgs = append(PackageSlice(nil), pkgs...)
+	pkgs.Sort()
+
+	m := make(GenericMap)
+
+	for i := len(pkgs) - 1; i >= 0; i-- {
+		for k, v := range pkgs[i].Domain {
+			m[k] = v
+		}
+	}
+
+	return m
+}
+
 // ObjectQName returns a qualified name: objclass/objname
 func ObjectQName(cls string, name string) string {
 	return fmt.Sprintf("%s/%s", cls, name)
 }
 
+// ValidateObjectName checks the name attribute of an object against its file name
+func ValidateObjectName(name string, obj interface{}) error {
+	n := JSONValue(obj, "name")
+	if n == nil || n.(string) == "" {
+		return fmt.Errorf("missing 'name' attribute for object: %s", name)
+	}
+
+	if name != n {
+		return fmt.Errorf("mismatch: object name: %s, file name: %s", n, name)
+	}
+
+	return nil
+}
+
 // GetObjectPackage returns the package where the object is saved
 func GetObjectPackage(pkgs PackageSlice, qname string) (*Package, error) {
 	for _, pkg := range pkgs {
@@ -204,16 +431,16 @@ func GetFilePackage(pkgs PackageSlice, path string) (*Package, error) {
 	return nil, nil
 }
 
-// SaveObject writes the configuration object to a file
-func SaveObject(pkgDir string, qname string, obj interface{}) (string, bool, error) {
+// SaveObject writes the configuration object to a file formatted as declared by the package
+func SaveObject(pkg *Package, cls string, name string, obj interface{}) (string, bool, error) {
 	new := false
 
-	p, err := filepath.Abs(pkgDir)
+	p, err := filepath.Abs(pkg.Dir)
 	if err != nil {
 		return "", new, err
 	}
 
-	f := filepath.Join(p, "objects", fmt.Sprintf("%s.json", qname))
+	f := filepath.Join(p, "objects", cls, fmt.Sprintf("%s.json", name))
 	if err := os.MkdirAll(filepath.Dir(f), 0777); err != nil {
 		return "", new, err
 	}
@@ -227,7 +454,12 @@ func SaveObject(pkgDir string, qname string, obj interface{}) (string, bool, err
 		}
 	}
 
-	if err := WriteDataToFile(obj, f); err != nil {
+	b, err := pkg.ObjectFormat().FormatObject(cls, obj)
+	if err != nil {
+		return "", new, err
+	}
+
+	if err := ioutil.WriteFile(f, b, 0644); err != nil {
 		return "", new, err
 	}
 
@@ -270,10 +502,18 @@ type ObjectInfo struct {
 	Class   string
 	Package *Package
 	File    string
+	// Patches are the patch files applied to the object, in application order
+	Patches []*ObjectPatch
 	data    interface{}
 	depend  []string
 }
 
+// ObjectPatch describes a project object patch
+type ObjectPatch struct {
+	Package *Package
+	File    string
+}
+
 // ObjectInfoSlice is a slice of objects
 type ObjectInfoSlice []*ObjectInfo
 
@@ -282,18 +522,49 @@ func (objInfo *ObjectInfo) QName() string {
 	return ObjectQName(objInfo.Class, objInfo.Name)
 }
 
-// Data returns the object data
+// NewObjectInfo returns an object with its data, e.g. an object no longer in the project
+func NewObjectInfo(cls string, name string, data interface{}) *ObjectInfo {
+	return &ObjectInfo{
+		Name:  name,
+		Class: cls,
+		data:  data,
+	}
+}
+
+// Data returns the object data with the patches applied
 func (objInfo *ObjectInfo) Data() (interface{}, error) {
 	if objInfo.data != nil {
 		return objInfo.data, nil
 	}
 
 	var err error
-	objInfo.data, err = ReadDataFromFile(objInfo.File)
+	objInfo.data, err = objInfo.ReadData()
 
 	return objInfo.data, err
 }
 
+// ReadData reads the object data and applies the patches, the data is not cached
+func (objInfo *ObjectInfo) ReadData() (interface{}, error) {
+	data, err := ReadDataFromFile(objInfo.File)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range objInfo.Patches {
+		patch, err := ReadDataFromFile(p.File)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = ApplyPatch(data, patch)
+		if err != nil {
+			return nil, fmt.Errorf("patch %s [%s]: %v", filepath.Base(p.File), p.Package.Name, err)
+		}
+	}
+
+	return data, nil
+}
+
 // Depend returns the object dependencies
 func (objInfo *ObjectInfo) Depend() ([]string, error) {
 	if objInfo.depend != nil {
@@ -310,11 +581,26 @@ func (objInfo *ObjectInfo) Depend() ([]string, error) {
 	return objInfo.depend, nil
 }
 
+// ProblemFunc is the type of the function called for each inconsistency found while
+// reading the project, the walk continues if the function returns nil
+type ProblemFunc func(path string, err error) error
+
 // GetProjectObjects returns the project objects for the selected packages
 func GetProjectObjects(pkgs PackageSlice) (ObjectInfoSlice, error) {
+	return ScanProjectObjects(pkgs, nil)
+}
+
+// ScanProjectObjects returns the project objects for the selected packages
+// reporting the inconsistencies to problemFn, nil stops at the first one
+func ScanProjectObjects(pkgs PackageSlice, problemFn ProblemFunc) (ObjectInfoSlice, error) {
 	pkgs.Sort()
 
+	if problemFn == nil {
+		problemFn = failProblem
+	}
+
 	m := make(map[string]*ObjectInfo)
+	patches := make(map[string][]*ObjectPatch)
 
 	var objectsDir string
 	var cls string
@@ -332,7 +618,11 @@ func GetProjectObjects(pkgs PackageSlice) (ObjectInfoSlice, error) {
 			}
 
 			if filepath.Dir(path) != objectsDir {
-				return fmt.Errorf("unexpected package directory: %v", path)
+				if err := problemFn(path, errors.New("unexpected package directory")); err != nil {
+					return err
+				}
+
+				return filepath.SkipDir
 			}
 
 			cls = info.Name()
@@ -345,13 +635,23 @@ func GetProjectObjects(pkgs PackageSlice) (ObjectInfoSlice, error) {
 		}
 
 		if filepath.Dir(path) == objectsDir {
-			return fmt.Errorf("unexpected package file: %v", path)
+			return problemFn(path, errors.New("unexpected package file"))
 		}
 
 		n := filepath.Base(path)
 
+		if strings.HasSuffix(n, PatchExt) {
+			qn := ObjectQName(cls, n[0:len(n)-len(PatchExt)])
+			patches[qn] = append(patches[qn], &ObjectPatch{
+				Package: pkg,
+				File:    path,
+			})
+
+			return nil
+		}
+
 		if filepath.Ext(n) != ".json" {
-			return fmt.Errorf("object file must have the 'json' extension: %v", path)
+			return problemFn(path, errors.New("object file must have the 'json' extension"))
 		}
 
 		objInfo = &ObjectInfo{
@@ -388,6 +688,10 @@ func GetProjectObjects(pkgs PackageSlice) (ObjectInfoSlice, error) {
 		}
 	}
 
+	if err := applyObjectPatches(m, patches, problemFn); err != nil {
+		return nil, err
+	}
+
 	objects := make(ObjectInfoSlice, 0, len(m))
 
 	for _, objInfo := range m {
@@ -397,6 +701,37 @@ func GetProjectObjects(pkgs PackageSlice) (ObjectInfoSlice, error) {
 	return objects, nil
 }
 
+// applyObjectPatches attaches the patches to the objects, a patch applies to the
+// object of the same or a lower priority package; the patches are collected in
+// decreasing priority order and attached in increasing priority order
+func applyObjectPatches(m map[string]*ObjectInfo, patches map[string][]*ObjectPatch, problemFn ProblemFunc) error {
+	for qn, l := range patches {
+		objInfo, ok := m[qn]
+		if !ok {
+			for _, p := range l {
+				if err := problemFn(p.File, fmt.Errorf("patch target object not found: %s", qn)); err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		for i := len(l) - 1; i >= 0; i-- {
+			p := l[i]
+
+			if p.Package.Priority > objInfo.Package.Priority {
+				log.DbgLogger4.Printf("package patch ignored: %s [%s], object from [%s]", qn, p.Package.Name, objInfo.Package.Name)
+				continue
+			}
+
+			objInfo.Patches = append(objInfo.Patches, p)
+		}
+	}
+
+	return nil
+}
+
 // FileInfo describes a project object
 type FileInfo struct {
 	Path    string
@@ -420,8 +755,18 @@ func (fileInfo *FileInfo) Data() ([]byte, error) {
 
 // GetProjectFiles returns the project files for the selected packages
 func GetProjectFiles(pkgs PackageSlice) (FileInfoSlice, error) {
+	return ScanProjectFiles(pkgs, nil)
+}
+
+// ScanProjectFiles returns the project files for the selected packages
+// reporting the inconsistencies to problemFn, nil stops at the first one
+func ScanProjectFiles(pkgs PackageSlice, problemFn ProblemFunc) (FileInfoSlice, error) {
 	pkgs.Sort()
 
+	if problemFn == nil {
+		problemFn = failProblem
+	}
+
 	m := make(map[string]*FileInfo)
 
 	var filesDir string
@@ -446,7 +791,7 @@ func GetProjectFiles(pkgs PackageSlice) (FileInfoSlice, error) {
 		}
 
 		if filepath.Dir(path) == filesDir {
-			return fmt.Errorf("unexpected package file: %v", path)
+			return problemFn(path, errors.New("unexpected package file"))
 		}
 
 		rel, err := filepath.Rel(filesDir, path)
@@ -494,6 +839,11 @@ func GetProjectFiles(pkgs PackageSlice) (FileInfoSlice, error) {
 	return files, nil
 }
 
+// failProblem stops the walk at the first inconsistency
+func failProblem(path string, err error) error {
+	return fmt.Errorf("%s: %v", err.Error(), path)
+}
+
 // IsHidden return true for a hidden file or directory, false otherwise
 func IsHidden(path string) bool {
 	if filepath.Base(path)[0:1] == "." {
@@ -509,98 +859,93 @@ func IsHidden(path string) bool {
 func Depend(obj interface{}) []string {
 	dep := make([]string, 0, 0)
 
-	for _, v := range obj.(GenericMap) {
+	walkRefs(obj.(GenericMap), func(m GenericMap) bool {
+		if qn, ok := RefQName(m); ok {
+			dep = append(dep, qn)
+			return true
+		}
+
+		return false
+	})
+
+	return dep
+}
+
+// RefErrors returns the errors of the malformed object references
+func RefErrors(obj interface{}) []error {
+	var errs []error
+
+	walkRefs(obj.(GenericMap), func(m GenericMap) bool {
+		_, ok, err := ParseRef(m)
+		if err != nil {
+			errs = append(errs, err)
+			return true
+		}
+
+		return ok
+	})
+
+	return errs
+}
+
+// walkRefs calls refFn for all nested maps not consumed by a previous call
+func walkRefs(obj GenericMap, refFn func(m GenericMap) bool) {
+	for _, v := range obj {
 		switch reflect.ValueOf(v).Kind() {
 		case reflect.Map:
 			o := v.(GenericMap)
-			if qn, ok := RefQName(o); ok {
-				dep = append(dep, qn)
-			} else {
-				dep = append(dep, Depend(o)...)
+			if !refFn(o) {
+				walkRefs(o, refFn)
 			}
 		case reflect.Slice:
 			for _, sv := range v.([]interface{}) {
 				if reflect.ValueOf(sv).Kind() == reflect.Map {
 					o := sv.(GenericMap)
-					if qn, ok := RefQName(o); ok {
-						dep = append(dep, qn)
-					} else {
-						dep = append(dep, Depend(o)...)
+					if !refFn(o) {
+						walkRefs(o, refFn)
 					}
 				}
 			}
 		}
 	}
-
-	return dep
 }
 
 // RefQName returns the reference object QName
 func RefQName(m GenericMap) (string, bool) {
-	if len(m) != 2 {
+	qn, ok, err := ParseRef(m)
+	if err != nil {
+		log.ErrLogger.Printf("Error: %s", err.Error())
 		return "", false
 	}
 
-	href, ok := m["href"]
-	if !ok {
-		return "", false
-	}
+	return qn, ok
+}
 
-	val, ok := m["value"]
-	if !ok {
-		return "", false
+// ParseRef returns the reference object QName, the error is set
+// if the map is a reference with mismatching href and value
+func ParseRef(m GenericMap) (string, bool, error) {
+	if len(m) != 2 {
+		return "", false, nil
 	}
 
-	hrefs := href.(string)
-	vals := val.(string)
-
-	s := strings.Split(hrefs, "/")
-	if len(s) != 6 {
-		return "", false
+	href, ok := m["href"].(string)
+	if !ok {
+		return "", false, nil
 	}
 
-	if s[5] != vals {
-		log.ErrLogger.Printf("Error: href and value do not match: %s, %s", hrefs, vals)
-		return "", false
+	val, ok := m["value"].(string)
+	if !ok {
+		return "", false, nil
 	}
 
-	return fmt.Sprintf("%s/%s", s[4], vals), true
-}
-
-// Sort reorder the objects based on their dependencies
-func (s ObjectInfoSlice) Sort() {
-	m := make(map[string]*ObjectInfo)
-	var qns []string
-
-	for _, obj := range s {
-		m[obj.QName()] = obj
-		qns = append(qns, obj.QName())
+	s := strings.Split(href, "/")
+	if len(s) != 6 {
+		return "", false, nil
 	}
 
-	s = s[:0]
-
-	sort.Strings(qns)
-
-	var addObjAndDependFn func(o *ObjectInfo)
-	addObjAndDependFn = func(obj *ObjectInfo) {
-		delete(m, obj.QName())
-
-		if depend, err := obj.Depend(); err == nil {
-			sort.Strings(qns)
-
-			for _, qn := range depend {
-				if o, ok := m[qn]; ok {
-					addObjAndDependFn(o)
-				}
-			}
-		}
-
-		s = append(s, obj)
+	if s[5] != val {
+		return "", false, fmt.Errorf("href and value do not match: %s, %s", href, val)
 	}
 
-	for _, qn := range qns {
-		if obj, ok := m[qn]; ok {
-			addObjAndDependFn(obj)
-		}
-	}
+	return fmt.Sprintf("%s/%s", s[4], val), true, nil
 }
@@ -0,0 +1,136 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+)
+
+func packageNames(pkgs PackageSlice) []string {
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestLoadPackagesImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"project/app/metadata.json":      `{"priority": 1, "tags": ["app"], "requires": ["logging"], "imports": ["../../shared/logging", "crypto"]}`,
+		"project/other/metadata.json":    `{"priority": 2, "tags": ["other"]}`,
+		"shared/logging/metadata.json":   `{"priority": 5, "requires": ["crypto"], "imports": ["crypto"]}`,
+		"cache/crypto/metadata.json":     `{"priority": 6}`,
+		"cache/crypto/objects/.keep":     ``,
+		"project/app/objects/.keep":      ``,
+		"shared/logging/objects/.keep":   ``,
+		"project/other/objects/.keep":    ``,
+		"project/notapackage/readme.txt": ``,
+	})
+
+	pkgs, err := LoadPackages(filepath.Join(dir, "project"), filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "app,crypto,logging,other"
+	if names := strings.Join(packageNames(pkgs), ","); names != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, names)
+	}
+
+	for _, pkg := range pkgs {
+		external := pkg.Name == "crypto" || pkg.Name == "logging"
+		if pkg.External != external {
+			t.Errorf("Expected external '%v' for '%v', got '%v'", external, pkg.Name, pkg.External)
+		}
+	}
+
+	selected := FilterPackages(pkgs, []string{"app"})
+
+	expected = "app,crypto,logging"
+	if names := strings.Join(packageNames(selected), ","); names != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, names)
+	}
+
+	if selected[0].Name != "app" || selected[2].Name != "crypto" {
+		t.Errorf("Expected the packages sorted by priority, got '%v', '%v', '%v'", selected[0].Name, selected[1].Name, selected[2].Name)
+	}
+}
+
+func TestLoadPackagesErrors(t *testing.T) {
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{
+				"project/a/metadata.json": `{"requires": ["b"]}`,
+				"project/b/metadata.json": `{"requires": ["c"]}`,
+				"project/c/metadata.json": `{"requires": ["b"]}`,
+			},
+			"package dependency cycle: b -> c -> b",
+		},
+		{
+			map[string]string{
+				"project/a/metadata.json": `{"requires": ["x"]}`,
+			},
+			"package a requires unknown package x",
+		},
+		{
+			map[string]string{
+				"project/a/metadata.json": `{"imports": ["missing"]}`,
+			},
+			"package a imports missing: package not found",
+		},
+		{
+			map[string]string{
+				"project/a/metadata.json": `{"imports": ["a"]}`,
+				"cache/a/metadata.json":   `{}`,
+			},
+			"duplicate package name: a",
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "dpctl")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fixture.WriteFiles(t, dir, test.files)
+
+		_, err = LoadPackages(filepath.Join(dir, "project"), filepath.Join(dir, "cache"))
+		if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+			t.Errorf("Expected '%v', got '%v'", test.expected, err)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
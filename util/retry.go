@@ -0,0 +1,85 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RetryPolicy describes how the failed idempotent requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each subsequent retry
+	Backoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+	// StatusCodes are the HTTP status codes that are retried
+	StatusCodes []int
+}
+
+// retryable reports whether a failed request can be sent again
+func (p *RetryPolicy) retryable(method string, statusCode int, rsBody interface{}) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+	default:
+		return false
+	}
+
+	// no response received: connection reset, timeout, ...
+	if statusCode == 0 {
+		return true
+	}
+
+	for _, c := range p.StatusCodes {
+		if c == statusCode {
+			return true
+		}
+	}
+
+	return isResourceBusy(rsBody)
+}
+
+// backoff returns the delay before the next attempt, with jitter
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// isResourceBusy reports whether the DataPower error messages report a busy resource
+func isResourceBusy(rsBody interface{}) bool {
+	for _, e := range JSONArray(JSONValue(rsBody, "error")) {
+		if strings.Contains(strings.ToLower(fmt.Sprint(e)), "busy") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientDoRetry(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch {
+		case n == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<html>Service Unavailable</html>`)
+		case n == 2:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error": "Resource busy, try again later"}`)
+		default:
+			fmt.Fprint(w, `{"result": "ok"}`)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.Client(), ts.URL, "", "", "")
+	c.RetryPolicy = RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		StatusCodes: []int{503},
+	}
+
+	rsBody, err := c.Do(context.Background(), "GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if JSONValue(rsBody, "result") != "ok" {
+		t.Errorf("Expected '%v', got '%v'", "ok", rsBody)
+	}
+
+	if c.Retries() != 2 {
+		t.Errorf("Expected '%v' retries, got '%v'", 2, c.Retries())
+	}
+
+	n = 0
+	if _, err = c.Do(context.Background(), "POST", ts.URL, nil); err == nil {
+		t.Errorf("Expected POST request not to be retried")
+	}
+
+	if n != 1 {
+		t.Errorf("Expected '%v' attempts, got '%v'", 1, n)
+	}
+}
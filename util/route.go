@@ -0,0 +1,118 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// PackageRoutes are the regular expressions routing the new DataPower items to a
+// package, an object is routed by its qualified name or its class, a file by its path
+type PackageRoutes struct {
+	Objects []string `json:"objects"`
+	Classes []string `json:"classes"`
+	Files   []string `json:"files"`
+
+	objects []*regexp.Regexp
+	classes []*regexp.Regexp
+	files   []*regexp.Regexp
+}
+
+func (r *PackageRoutes) compile() error {
+	var err error
+
+	if r.objects, err = compileRoutes(r.Objects); err != nil {
+		return err
+	}
+
+	if r.classes, err = compileRoutes(r.Classes); err != nil {
+		return err
+	}
+
+	r.files, err = compileRoutes(r.Files)
+
+	return err
+}
+
+func compileRoutes(exprs []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %s", expr, err.Error())
+		}
+
+		res = append(res, re)
+	}
+
+	return res, nil
+}
+
+func matchRoutes(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasRoutes reports whether any project package declares routes, the imported
+// packages never receive new items
+func HasRoutes(pkgs PackageSlice) bool {
+	for _, pkg := range pkgs {
+		if !pkg.External && pkg.Routes != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RouteObject returns the highest priority project package with a route matching
+// the object, nil if no route matches
+func RouteObject(pkgs PackageSlice, cls string, name string) *Package {
+	qn := ObjectQName(cls, name)
+
+	for _, pkg := range pkgs {
+		if pkg.External || pkg.Routes == nil {
+			continue
+		}
+
+		if matchRoutes(pkg.Routes.objects, qn) || matchRoutes(pkg.Routes.classes, cls) {
+			return pkg
+		}
+	}
+
+	return nil
+}
+
+// RouteFile returns the highest priority project package with a route matching
+// the file path, nil if no route matches
+func RouteFile(pkgs PackageSlice, path string) *Package {
+	for _, pkg := range pkgs {
+		if pkg.External || pkg.Routes == nil {
+			continue
+		}
+
+		if matchRoutes(pkg.Routes.files, path) {
+			return pkg
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lfeier/dpctl/dptest/fixture"
+)
+
+func TestRoutePackages(t *testing.T) {
+	pkgs := PackageSlice{
+		{Name: "imported", Priority: 1, External: true, Routes: &PackageRoutes{Classes: []string{".*"}}},
+		{Name: "app", Priority: 2, Routes: &PackageRoutes{Objects: []string{"^MultiProtocolGateway/app-"}, Files: []string{"^local/app/"}}},
+		{Name: "common", Priority: 3, Routes: &PackageRoutes{Classes: []string{"^(XMLManager|HTTPUserAgent)$"}, Files: []string{"^local/"}}},
+	}
+
+	for _, pkg := range pkgs {
+		if err := pkg.Routes.compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !HasRoutes(pkgs) {
+		t.Errorf("Expected routes")
+	}
+
+	objects := []struct {
+		cls, name, expected string
+	}{
+		{"MultiProtocolGateway", "app-gw", "app"},
+		{"XMLManager", "xm", "common"},
+		{"MultiProtocolGateway", "other-gw", ""},
+	}
+
+	for _, o := range objects {
+		if got := packageName(RouteObject(pkgs, o.cls, o.name)); got != o.expected {
+			t.Errorf("%s/%s: expected '%v', got '%v'", o.cls, o.name, o.expected, got)
+		}
+	}
+
+	files := []struct {
+		path, expected string
+	}{
+		{"local/app/a.xsl", "app"},
+		{"local/b.xml", "common"},
+		{"store/c.xsl", ""},
+	}
+
+	for _, f := range files {
+		if got := packageName(RouteFile(pkgs, f.path)); got != f.expected {
+			t.Errorf("%s: expected '%v', got '%v'", f.path, f.expected, got)
+		}
+	}
+
+	if HasRoutes(PackageSlice{{Name: "a"}, pkgs[0]}) {
+		t.Errorf("Expected no routes, the imported packages are not routed")
+	}
+}
+
+func TestInvalidRoute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture.WriteFiles(t, dir, map[string]string{
+		"app/metadata.json": `{"routes": {"files": ["^local/("]}}`,
+	})
+
+	_, err = LoadPackages(dir, "")
+	if err == nil || !strings.HasPrefix(err.Error(), "package app: invalid route ^local/(") {
+		t.Errorf("Expected an invalid route error, got '%v'", err)
+	}
+}
+
+func packageName(pkg *Package) string {
+	if pkg == nil {
+		return ""
+	}
+
+	return pkg.Name
+}
@@ -0,0 +1,454 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lfeier/dpctl/log"
+)
+
+// ClassSchema describes a configuration object class
+type ClassSchema struct {
+	Name       string
+	Properties map[string]*PropertySchema
+}
+
+// PropertySchema describes a configuration object property
+type PropertySchema struct {
+	Name     string
+	Type     *TypeSchema
+	RefClass string
+	Vector   bool
+	Required bool
+	ReadOnly bool
+	Default  interface{}
+}
+
+// TypeSchema describes a property type
+type TypeSchema struct {
+	Name       string
+	Base       string
+	Values     []string
+	Min        *float64
+	Max        *float64
+	Properties map[string]*PropertySchema
+}
+
+// SchemaRepository loads the class metadata from DataPower
+// caching it locally per firmware version
+type SchemaRepository struct {
+	ctx      context.Context
+	dp       DataPower
+	cacheDir string
+	mutex    sync.Mutex
+	classes  map[string]*ClassSchema
+	types    map[string]*TypeSchema
+}
+
+// NewSchemaRepository creates a schema repository, the metadata is cached
+// in a firmware version subdirectory of cacheDir unless cacheDir is empty
+func NewSchemaRepository(ctx context.Context, dp DataPower, cacheDir string) (*SchemaRepository, error) {
+	r := &SchemaRepository{
+		ctx:     ctx,
+		dp:      dp,
+		classes: make(map[string]*ClassSchema),
+		types:   make(map[string]*TypeSchema),
+	}
+
+	if cacheDir != "" {
+		v, err := dp.GetFirmwareVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		r.cacheDir = filepath.Join(cacheDir, v)
+		log.DbgLogger2.Println("schema cache directory:", r.cacheDir)
+	}
+
+	return r, nil
+}
+
+// Class returns the schema of a configuration class, nil if the class is unknown
+func (r *SchemaRepository) Class(class string) (*ClassSchema, error) {
+	r.mutex.Lock()
+	c, ok := r.classes[class]
+	r.mutex.Unlock()
+
+	if ok {
+		return c, nil
+	}
+
+	m, err := r.fetch(filepath.Join("metadata", fmt.Sprintf("%s.json", class)), func() (interface{}, error) {
+		return r.dp.GetClassMetadata(r.ctx, class)
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	// the types are published only once the class is resolved, a failed fetch is retried
+	types := make(map[string]*TypeSchema)
+
+	props, err := r.parseProperties(JSONValue(m, "object", "properties", "property"), types)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if c, ok := r.classes[class]; ok {
+		return c, nil
+	}
+
+	c = &ClassSchema{
+		Name:       class,
+		Properties: props,
+	}
+
+	r.classes[class] = c
+
+	for n, t := range types {
+		if _, ok := r.types[n]; !ok {
+			r.types[n] = t
+		}
+	}
+
+	return c, nil
+}
+
+// ValidateObject validates an object against the schema of its class
+func (r *SchemaRepository) ValidateObject(class string, obj interface{}) ([]error, error) {
+	c, err := r.Class(class)
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		return []error{fmt.Errorf("unknown class: %s", class)}, nil
+	}
+
+	return c.Validate(obj), nil
+}
+
+func (r *SchemaRepository) parseProperties(l interface{}, types map[string]*TypeSchema) (map[string]*PropertySchema, error) {
+	props := make(map[string]*PropertySchema)
+
+	for _, p := range JSONArray(l) {
+		n, _ := JSONValue(p, "name").(string)
+		if n == "" {
+			continue
+		}
+
+		ps := &PropertySchema{
+			Name:     n,
+			Vector:   schemaBool(JSONValue(p, "vector")),
+			Required: schemaBool(JSONValue(p, "required")),
+			ReadOnly: schemaBool(JSONValue(p, "read-only")),
+			Default:  JSONValue(p, "default"),
+		}
+
+		ps.RefClass, _ = JSONValue(p, "reftype").(string)
+
+		if href, ok := JSONValue(p, "type", "href").(string); ok {
+			t, err := r.typeSchema(href, types)
+			if err != nil {
+				return nil, err
+			}
+
+			ps.Type = t
+		}
+
+		props[n] = ps
+	}
+
+	return props, nil
+}
+
+// typeSchema returns the schema of a type, the types resolved by the current
+// class are in types until it is complete
+func (r *SchemaRepository) typeSchema(href string, types map[string]*TypeSchema) (*TypeSchema, error) {
+	name := path.Base(href)
+
+	if t, ok := types[name]; ok {
+		return t, nil
+	}
+
+	r.mutex.Lock()
+	t, ok := r.types[name]
+	r.mutex.Unlock()
+
+	if ok {
+		return t, nil
+	}
+
+	t = &TypeSchema{
+		Name: name,
+	}
+
+	// registered first to stop the recursion of self referencing complex types
+	types[name] = t
+
+	m, err := r.fetch(filepath.Join("types", fmt.Sprintf("%s.json", name)), func() (interface{}, error) {
+		return r.dp.GetTypeMetadata(r.ctx, href)
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			log.DbgLogger2.Println("unknown type:", name)
+			return t, nil
+		}
+
+		return nil, err
+	}
+
+	td := JSONValue(m, "type")
+
+	t.Base, _ = JSONValue(td, "base").(string)
+	t.Min = schemaNumber(JSONValue(td, "minimum"))
+	t.Max = schemaNumber(JSONValue(td, "maximum"))
+
+	for _, v := range JSONArray(JSONValue(td, "value-list", "value")) {
+		if n, ok := JSONValue(v, "name").(string); ok {
+			t.Values = append(t.Values, n)
+		}
+	}
+
+	if l := JSONValue(td, "properties", "property"); l != nil {
+		t.Properties, err = r.parseProperties(l, types)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// fetch returns the cached metadata or retrieves it using fetchFn
+func (r *SchemaRepository) fetch(file string, fetchFn func() (interface{}, error)) (interface{}, error) {
+	var f string
+
+	if r.cacheDir != "" {
+		f = filepath.Join(r.cacheDir, file)
+
+		if data, err := ReadDataFromFile(f); err == nil {
+			return data, nil
+		}
+	}
+
+	data, err := fetchFn()
+	if err != nil {
+		return nil, err
+	}
+
+	if f != "" {
+		if err := os.MkdirAll(filepath.Dir(f), 0777); err != nil {
+			log.DbgLogger2.Println("schema cache error:", err.Error())
+		} else if err := WriteDataToFile(data, f); err != nil {
+			log.DbgLogger2.Println("schema cache error:", err.Error())
+		}
+	}
+
+	return data, nil
+}
+
+// Validate returns the schema violations of a configuration object
+func (c *ClassSchema) Validate(obj interface{}) []error {
+	errs := validateProperties("", c.Properties, obj)
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+
+	return errs
+}
+
+func validateProperties(prefix string, props map[string]*PropertySchema, v interface{}) []error {
+	m, ok := v.(GenericMap)
+	if !ok {
+		return []error{fmt.Errorf("%s: expected a JSON object", schemaPath(prefix, ""))}
+	}
+
+	var errs []error
+
+	for k, pv := range m {
+		if k == "_links" || k == "href" || (prefix == "" && k == "name") {
+			continue
+		}
+
+		p, ok := props[k]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown property", schemaPath(prefix, k)))
+			continue
+		}
+
+		// the read-only properties are in the exported objects and ignored by DataPower
+		if p.ReadOnly {
+			continue
+		}
+
+		if a, ok := pv.(GenericArray); ok {
+			if !p.Vector {
+				errs = append(errs, fmt.Errorf("%s: not a vector property", schemaPath(prefix, k)))
+				continue
+			}
+
+			for i, av := range a {
+				errs = append(errs, p.validateValue(fmt.Sprintf("%s[%d]", schemaPath(prefix, k), i), av)...)
+			}
+		} else {
+			errs = append(errs, p.validateValue(schemaPath(prefix, k), pv)...)
+		}
+	}
+
+	for n, p := range props {
+		if _, ok := m[n]; !ok && p.Required {
+			errs = append(errs, fmt.Errorf("%s: missing required property", schemaPath(prefix, n)))
+		}
+	}
+
+	return errs
+}
+
+func (p *PropertySchema) validateValue(path string, v interface{}) []error {
+	if p.RefClass != "" {
+		ref, ok := v.(GenericMap)
+		if !ok {
+			return []error{fmt.Errorf("%s: expected a reference to %s", path, p.RefClass)}
+		}
+
+		if _, ok := ref["value"].(string); !ok {
+			return []error{fmt.Errorf("%s: missing reference value", path)}
+		}
+
+		if href, ok := ref["href"].(string); ok {
+			s := strings.Split(href, "/")
+			if len(s) == 6 && s[4] != p.RefClass {
+				return []error{fmt.Errorf("%s: invalid reference class %s, expected %s", path, s[4], p.RefClass)}
+			}
+		}
+
+		return nil
+	}
+
+	if p.Type == nil {
+		return nil
+	}
+
+	switch p.Type.Base {
+	case "enumeration":
+		s, ok := v.(string)
+		if !ok || !stringIn(s, p.Type.Values) {
+			return []error{fmt.Errorf("%s: invalid value '%v', expected one of %v", path, v, p.Type.Values)}
+		}
+	case "bitmap":
+		m, ok := v.(GenericMap)
+		if !ok {
+			return []error{fmt.Errorf("%s: expected a JSON object", path)}
+		}
+
+		var errs []error
+		for k, bv := range m {
+			if !stringIn(k, p.Type.Values) {
+				errs = append(errs, fmt.Errorf("%s: unknown flag %s, expected one of %v", path, k, p.Type.Values))
+			} else if bv != "on" && bv != "off" {
+				errs = append(errs, fmt.Errorf("%s: invalid value '%v' for flag %s, expected on or off", path, bv, k))
+			}
+		}
+
+		return errs
+	case "complex":
+		return validateProperties(path, p.Type.Properties, v)
+	case "string":
+		if _, ok := v.(string); !ok {
+			return []error{fmt.Errorf("%s: invalid value '%v', expected a string", path, v)}
+		}
+	case "uint8", "uint16", "uint32", "uint64", "int8", "int16", "int32", "int64":
+		n := schemaNumber(v)
+		if n == nil {
+			return []error{fmt.Errorf("%s: invalid value '%v', expected a number", path, v)}
+		}
+
+		if (p.Type.Min != nil && *n < *p.Type.Min) || (p.Type.Max != nil && *n > *p.Type.Max) {
+			return []error{fmt.Errorf("%s: value %v out of range [%v, %v]", path, v, schemaBound(p.Type.Min), schemaBound(p.Type.Max))}
+		}
+	}
+
+	return nil
+}
+
+func schemaPath(prefix, name string) string {
+	switch {
+	case prefix == "":
+		return name
+	case name == "":
+		return prefix
+	default:
+		return fmt.Sprintf("%s.%s", prefix, name)
+	}
+}
+
+func schemaBool(v interface{}) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		return t == "true"
+	default:
+		return false
+	}
+}
+
+func schemaNumber(v interface{}) *float64 {
+	switch t := v.(type) {
+	case float64:
+		return &t
+	case string:
+		if n, err := strconv.ParseFloat(t, 64); err == nil {
+			return &n
+		}
+	}
+
+	return nil
+}
+
+func schemaBound(n *float64) interface{} {
+	if n == nil {
+		return "-"
+	}
+
+	return *n
+}
+
+func stringIn(s string, a []string) bool {
+	for _, v := range a {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
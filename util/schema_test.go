@@ -0,0 +1,143 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestClassSchemaValidate(t *testing.T) {
+	max := float64(10)
+
+	c := &ClassSchema{
+		Name: "XMLManager",
+		Properties: map[string]*PropertySchema{
+			"mAdminState": {
+				Name: "mAdminState",
+				Type: &TypeSchema{Name: "dmAdminState", Base: "enumeration", Values: []string{"enabled", "disabled"}},
+			},
+			"CacheSize": {
+				Name:     "CacheSize",
+				Type:     &TypeSchema{Name: "dmUInt32", Base: "uint32", Max: &max},
+				Required: true,
+			},
+			"UserAgent": {
+				Name:     "UserAgent",
+				Type:     &TypeSchema{Name: "dmReference", Base: "dmReference"},
+				RefClass: "HTTPUserAgent",
+			},
+			"Rules": {
+				Name:   "Rules",
+				Vector: true,
+				Type: &TypeSchema{Name: "dmRule", Base: "complex", Properties: map[string]*PropertySchema{
+					"Match": {Name: "Match", Type: &TypeSchema{Name: "dmString", Base: "string"}},
+				}},
+			},
+			"Status": {
+				Name:     "Status",
+				Type:     &TypeSchema{Name: "dmString", Base: "string"},
+				ReadOnly: true,
+			},
+		},
+	}
+
+	var obj interface{}
+	err := json.Unmarshal([]byte(`{
+		"name": "xm1",
+		"mAdminState": "on",
+		"UserAgent": {"value": "ua", "href": "/mgmt/config/{domain}/XMLManager/ua"},
+		"Rules": [{"Match": "a"}, {"Match": 1, "Other": "b"}],
+		"Status": "up",
+		"Unknown": 1
+	}`), &obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"CacheSize: missing required property",
+		"Rules[1].Match: invalid value '1', expected a string",
+		"Rules[1].Other: unknown property",
+		"Unknown: unknown property",
+		"UserAgent: invalid reference class XMLManager, expected HTTPUserAgent",
+		"mAdminState: invalid value 'on', expected one of [enabled disabled]",
+	}
+
+	errs := c.Validate(obj)
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected '%v', got '%v'", expected, errs)
+	}
+
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("Expected '%v', got '%v'", expected[i], err.Error())
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"name": "xm2", "CacheSize": "11"}`), &obj); err != nil {
+		t.Fatal(err)
+	}
+
+	errs = c.Validate(obj)
+	if len(errs) != 1 || errs[0].Error() != "CacheSize: value 11 out of range [-, 10]" {
+		t.Errorf("Expected '%v', got '%v'", "CacheSize: value 11 out of range [-, 10]", errs)
+	}
+}
+
+// schemaDataPower serves the class metadata, the type metadata fetches fail
+// until fails is zero
+type schemaDataPower struct {
+	DataPower
+	fails int
+}
+
+func (dp *schemaDataPower) GetClassMetadata(ctx context.Context, class string) (interface{}, error) {
+	return GenericMap{"object": GenericMap{"name": class, "properties": GenericMap{"property": GenericMap{
+		"name": "CacheSize",
+		"type": GenericMap{"href": "/mgmt/metadata/latest/types/dmUInt32"},
+	}}}}, nil
+}
+
+func (dp *schemaDataPower) GetTypeMetadata(ctx context.Context, href string) (interface{}, error) {
+	if dp.fails > 0 {
+		dp.fails--
+		return nil, errors.New("connection reset")
+	}
+
+	return GenericMap{"type": GenericMap{"name": "dmUInt32", "base": "uint32"}}, nil
+}
+
+func TestSchemaRepositoryFetchError(t *testing.T) {
+	r, err := NewSchemaRepository(context.Background(), &schemaDataPower{fails: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Class("XMLManager"); err == nil {
+		t.Fatal("Expected the type fetch error")
+	}
+
+	c, err := r.Class("XMLManager")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := c.Properties["CacheSize"].Type.Base; b != "uint32" {
+		t.Errorf("Expected the type to be fetched again, got base '%s'", b)
+	}
+}
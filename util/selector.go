@@ -0,0 +1,333 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Selector is a boolean package selection expression
+type Selector interface {
+	Match(pkg *Package) bool
+	String() string
+}
+
+// ParseSelector parses a package selection expression made of tags, key=value tags,
+// AND, OR, NOT and parentheses, e.g. "env=prod AND (region=eu OR shared) AND NOT experimental";
+// a tag matches the packages with the tag or with a key=value tag of the same key
+func ParseSelector(expr string) (Selector, error) {
+	tokens, err := tokenizeSelector(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &selectorParser{tokens: tokens}
+
+	s, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid package selector: unexpected '%s'", p.tokens[p.pos])
+	}
+
+	return s, nil
+}
+
+type tagSelector struct {
+	key   string
+	value string
+	// hasValue is set for the key=value tags
+	hasValue bool
+}
+
+func (s *tagSelector) Match(pkg *Package) bool {
+	for _, t := range pkg.Tags {
+		kv := strings.SplitN(t, "=", 2)
+
+		if s.hasValue {
+			if len(kv) == 2 && kv[0] == s.key && kv[1] == s.value {
+				return true
+			}
+		} else if kv[0] == s.key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *tagSelector) String() string {
+	if s.hasValue {
+		return fmt.Sprintf("%s=%s", s.key, s.value)
+	}
+
+	return s.key
+}
+
+type notSelector struct {
+	s Selector
+}
+
+func (s *notSelector) Match(pkg *Package) bool {
+	return !s.s.Match(pkg)
+}
+
+func (s *notSelector) String() string {
+	return fmt.Sprintf("NOT %s", s.s.String())
+}
+
+type andSelector struct {
+	l, r Selector
+}
+
+func (s *andSelector) Match(pkg *Package) bool {
+	return s.l.Match(pkg) && s.r.Match(pkg)
+}
+
+func (s *andSelector) String() string {
+	return fmt.Sprintf("(%s AND %s)", s.l.String(), s.r.String())
+}
+
+type orSelector struct {
+	l, r Selector
+}
+
+func (s *orSelector) Match(pkg *Package) bool {
+	return s.l.Match(pkg) || s.r.Match(pkg)
+}
+
+func (s *orSelector) String() string {
+	return fmt.Sprintf("(%s OR %s)", s.l.String(), s.r.String())
+}
+
+func tokenizeSelector(expr string) ([]string, error) {
+	var tokens []string
+
+	r := []rune(expr)
+	for i := 0; i < len(r); {
+		c := r[i]
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')' || c == '=':
+			tokens = append(tokens, string(c))
+			i++
+		case isSelectorChar(c):
+			j := i
+			for j < len(r) && isSelectorChar(r[j]) {
+				j++
+			}
+
+			tokens = append(tokens, string(r[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("invalid package selector: unexpected '%c'", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isSelectorChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_-.:/", c)
+}
+
+type selectorParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *selectorParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *selectorParser) keyword(kw string) bool {
+	if strings.EqualFold(p.peek(), kw) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *selectorParser) parseOr() (Selector, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("OR") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		l = &orSelector{l: l, r: r}
+	}
+
+	return l, nil
+}
+
+func (p *selectorParser) parseAnd() (Selector, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("AND") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		l = &andSelector{l: l, r: r}
+	}
+
+	return l, nil
+}
+
+func (p *selectorParser) parseNot() (Selector, error) {
+	if p.keyword("NOT") {
+		s, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notSelector{s: s}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *selectorParser) parsePrimary() (Selector, error) {
+	t := p.peek()
+
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("invalid package selector: unexpected end")
+	case t == "(":
+		p.pos++
+
+		s, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("invalid package selector: missing ')'")
+		}
+
+		p.pos++
+
+		return s, nil
+	case t == ")" || t == "=" || isSelectorKeyword(t):
+		return nil, fmt.Errorf("invalid package selector: unexpected '%s'", t)
+	}
+
+	p.pos++
+
+	if p.peek() != "=" {
+		return &tagSelector{key: t}, nil
+	}
+
+	p.pos++
+
+	v := p.peek()
+	if v == "" || v == "(" || v == ")" || v == "=" {
+		return nil, fmt.Errorf("invalid package selector: missing value for '%s'", t)
+	}
+
+	p.pos++
+
+	return &tagSelector{key: t, value: v, hasValue: true}, nil
+}
+
+func isSelectorKeyword(t string) bool {
+	return strings.EqualFold(t, "AND") || strings.EqualFold(t, "OR") || strings.EqualFold(t, "NOT")
+}
+
+// PackageSelector selects the packages by tags, selection expression and names,
+// a package is selected when it matches all the criteria
+type PackageSelector struct {
+	// Tags are the tags the package must all have
+	Tags []string
+	// Expr is the selection expression, nil matches all packages
+	Expr Selector
+	// Names are the selected package names, empty matches all packages
+	Names []string
+}
+
+// Match reports whether the package is selected, the required packages are not considered
+func (s *PackageSelector) Match(pkg *Package) bool {
+	for _, t := range s.Tags {
+		if !pkg.HasTag(t) {
+			return false
+		}
+	}
+
+	if s.Expr != nil && !s.Expr.Match(pkg) {
+		return false
+	}
+
+	if len(s.Names) > 0 && !stringIn(pkg.Name, s.Names) {
+		return false
+	}
+
+	return true
+}
+
+// SelectPackages returns the selected packages and the packages they require,
+// transitively, sorted by priority
+func SelectPackages(pkgs PackageSlice, sel *PackageSelector) (PackageSlice, error) {
+	for _, name := range sel.Names {
+		found := false
+		for _, pkg := range pkgs {
+			if pkg.Name == name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown package: %s", name)
+		}
+	}
+
+	var s PackageSlice
+	for _, pkg := range pkgs {
+		if sel.Match(pkg) {
+			s = append(s, pkg)
+		}
+	}
+
+	s = requiredPackages(pkgs, s)
+
+	s.Sort()
+
+	return s, nil
+}
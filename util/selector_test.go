@@ -0,0 +1,110 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	pkgs := map[string]*Package{
+		"prod-eu":  {Name: "prod-eu", Tags: []string{"env=prod", "region=eu"}},
+		"prod-us":  {Name: "prod-us", Tags: []string{"env=prod", "region=us"}},
+		"prod-exp": {Name: "prod-exp", Tags: []string{"env=prod", "shared", "experimental"}},
+		"shared":   {Name: "shared", Tags: []string{"env=prod", "shared"}},
+		"test":     {Name: "test", Tags: []string{"env=test"}},
+	}
+
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"env=prod AND (region=eu OR shared) AND NOT experimental", []string{"prod-eu", "shared"}},
+		{"env=test or region=us", []string{"prod-us", "test"}},
+		{"region", []string{"prod-eu", "prod-us"}},
+		{"NOT NOT shared AND experimental", []string{"prod-exp"}},
+		{"env = prod AND region = us", []string{"prod-us"}},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSelector(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+
+		var matched []string
+		for _, name := range []string{"prod-eu", "prod-us", "prod-exp", "shared", "test"} {
+			if s.Match(pkgs[name]) {
+				matched = append(matched, name)
+			}
+		}
+
+		if len(matched) != len(test.expected) {
+			t.Errorf("%s: expected '%v', got '%v'", test.expr, test.expected, matched)
+			continue
+		}
+
+		for i := range matched {
+			if matched[i] != test.expected[i] {
+				t.Errorf("%s: expected '%v', got '%v'", test.expr, test.expected, matched)
+				break
+			}
+		}
+	}
+
+	if s, err := ParseSelector("  "); s != nil || err != nil {
+		t.Errorf("Expected an empty selector, got '%v', '%v'", s, err)
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	tests := []string{
+		"env=",
+		"(shared",
+		"shared)",
+		"shared AND",
+		"AND shared",
+		"shared OR OR test",
+		"env==prod",
+		"shared & test",
+	}
+
+	for _, test := range tests {
+		if _, err := ParseSelector(test); err == nil {
+			t.Errorf("Expected an error for '%v'", test)
+		}
+	}
+}
+
+func TestSelectPackages(t *testing.T) {
+	pkgs := PackageSlice{
+		{Name: "app", Priority: 1, Tags: []string{"env=prod"}, Requires: []string{"base"}},
+		{Name: "base", Priority: 2},
+		{Name: "other", Priority: 3, Tags: []string{"env=prod"}},
+	}
+
+	s, err := SelectPackages(pkgs, &PackageSelector{Tags: []string{"env=prod"}, Names: []string{"app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s) != 2 || s[0].Name != "app" || s[1].Name != "base" {
+		t.Errorf("Expected 'app' and the required 'base', got '%v'", packageNames(s))
+	}
+
+	if _, err := SelectPackages(pkgs, &PackageSelector{Names: []string{"missing"}}); err == nil {
+		t.Errorf("Expected an unknown package error")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lfeier/dpctl/log"
+)
+
+// Throttle limits the rate and the concurrency of the requests sent to DataPower
+type Throttle struct {
+	interval time.Duration
+	next     time.Time
+
+	adaptive   bool
+	maxLatency time.Duration
+	limit      float64
+	maxLimit   float64
+	inFlight   int
+	decreased  time.Time
+
+	mutex sync.Mutex
+	// released is closed and replaced when a request is released
+	released chan struct{}
+}
+
+// NewThrottle creates a throttle allowing rate requests per second, 0 for no limit;
+// in adaptive mode the concurrency is lowered when the latency exceeds maxLatency
+// or requests fail, and increased up to maxConcurrency when the appliance is healthy
+func NewThrottle(rate float64, adaptive bool, maxConcurrency int, maxLatency time.Duration) *Throttle {
+	t := &Throttle{
+		adaptive:   adaptive,
+		maxLatency: maxLatency,
+		limit:      float64(maxConcurrency),
+		maxLimit:   float64(maxConcurrency),
+		released:   make(chan struct{}),
+	}
+
+	if rate > 0 {
+		t.interval = time.Duration(float64(time.Second) / rate)
+	}
+
+	if t.maxLimit < 1 {
+		t.limit = 1
+		t.maxLimit = 1
+	}
+
+	return t
+}
+
+// Limit returns the current concurrency limit
+func (t *Throttle) Limit() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return int(t.limit)
+}
+
+// acquire blocks until a request can be sent or the context is done
+func (t *Throttle) acquire(ctx context.Context) error {
+	t.mutex.Lock()
+
+	if t.adaptive {
+		for t.inFlight >= int(t.limit) {
+			released := t.released
+			t.mutex.Unlock()
+
+			select {
+			case <-released:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			t.mutex.Lock()
+		}
+
+		t.inFlight++
+	}
+
+	var d time.Duration
+	if t.interval > 0 {
+		now := time.Now()
+		if t.next.Before(now) {
+			t.next = now
+		}
+
+		d = t.next.Sub(now)
+		t.next = t.next.Add(t.interval)
+	}
+
+	t.mutex.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		if t.adaptive {
+			t.mutex.Lock()
+			t.inFlight--
+			t.wake()
+			t.mutex.Unlock()
+		}
+
+		return ctx.Err()
+	}
+}
+
+// release records the outcome of a request adjusting the concurrency limit
+func (t *Throttle) release(latency time.Duration, failed bool) {
+	if !t.adaptive {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.inFlight--
+
+	limit := t.limit
+	if failed || (t.maxLatency > 0 && latency > t.maxLatency) {
+		// decrease at most once per latency window to absorb bursts of slow responses
+		if time.Since(t.decreased) > latency {
+			t.limit = t.limit / 2
+			if t.limit < 1 {
+				t.limit = 1
+			}
+
+			t.decreased = time.Now()
+		}
+	} else {
+		t.limit = t.limit + 1/t.limit
+		if t.limit > t.maxLimit {
+			t.limit = t.maxLimit
+		}
+	}
+
+	if int(limit) != int(t.limit) {
+		log.DbgLogger2.Printf("concurrency limit: %d", int(t.limit))
+	}
+
+	t.wake()
+}
+
+// wake unblocks the requests waiting for a release, the mutex must be held
+func (t *Throttle) wake() {
+	close(t.released)
+	t.released = make(chan struct{})
+}
@@ -0,0 +1,109 @@
+// Copyright © 2018 Lucian Feier
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottleRate(t *testing.T) {
+	th := NewThrottle(100, false, 1, 0)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		th.acquire(context.Background())
+		th.release(0, false)
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected at least '%v', got '%v'", 40*time.Millisecond, elapsed)
+	}
+}
+
+func TestThrottleAdaptive(t *testing.T) {
+	th := NewThrottle(0, true, 8, time.Second)
+
+	th.acquire(context.Background())
+	th.release(time.Millisecond, true)
+
+	if th.Limit() != 4 {
+		t.Errorf("Expected '%v', got '%v'", 4, th.Limit())
+	}
+
+	// slow responses within the same window do not decrease the limit again
+	th.acquire(context.Background())
+	th.release(2*time.Second, false)
+
+	if th.Limit() != 4 {
+		t.Errorf("Expected '%v', got '%v'", 4, th.Limit())
+	}
+
+	for i := 0; i < 100; i++ {
+		th.acquire(context.Background())
+		th.release(time.Millisecond, false)
+	}
+
+	if th.Limit() != 8 {
+		t.Errorf("Expected '%v', got '%v'", 8, th.Limit())
+	}
+}
+
+func TestThrottleCanceled(t *testing.T) {
+	th := NewThrottle(0, true, 1, time.Second)
+
+	if err := th.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := th.acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected '%v', got '%v'", context.DeadlineExceeded, err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- th.acquire(context.Background())
+	}()
+
+	th.release(time.Millisecond, false)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the waiting request to be released")
+	}
+
+	th = NewThrottle(1, false, 1, 0)
+	th.acquire(context.Background())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := th.acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected '%v', got '%v'", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the rate wait to be canceled, waited '%v'", elapsed)
+	}
+}